@@ -0,0 +1,214 @@
+package docrawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// custom errors
+var (
+	errLoginFailed = errors.New("login failed")
+)
+
+// Authenticator is a way of getting past a site's authentication. credentials are only ever
+// sent to the hosts they're for, never to remote hosts.
+type Authenticator interface {
+	// login does anything needed before the crawl starts, i.e. posting a login form. cookies
+	// it gets back are kept in the crawler's cookie jar, which sends them back to the same
+	// site only
+	login(ctx context.Context, c *crawler) error
+
+	// authorize adds credentials to req, if it's for a host they belong to
+	authorize(req *http.Request)
+}
+
+// sameHost returns whether u is on host, ignoring case
+func sameHost(u *url.URL, host string) bool {
+	return strings.EqualFold(u.Host, host)
+}
+
+// basicAuth sends a username and password to a single host with http basic auth
+type basicAuth struct {
+	host     string
+	username string
+	password string
+}
+
+// NewBasicAuth returns an Authenticator which logs in to host with http basic auth
+func NewBasicAuth(host, username, password string) Authenticator {
+	return &basicAuth{host: host, username: username, password: password}
+}
+
+// login implements Authenticator, basic auth has nothing to do up front
+func (a *basicAuth) login(ctx context.Context, c *crawler) error {
+	return nil
+}
+
+// authorize implements Authenticator
+func (a *basicAuth) authorize(req *http.Request) {
+	if sameHost(req.URL, a.host) {
+		req.SetBasicAuth(a.username, a.password)
+	}
+}
+
+// bearerAuth sends a bearer token to a single host
+type bearerAuth struct {
+	host  string
+	token string
+}
+
+// NewBearerAuth returns an Authenticator which sends token to host as a bearer token
+func NewBearerAuth(host, token string) Authenticator {
+	return &bearerAuth{host: host, token: token}
+}
+
+// login implements Authenticator, a bearer token has nothing to do up front
+func (a *bearerAuth) login(ctx context.Context, c *crawler) error {
+	return nil
+}
+
+// authorize implements Authenticator
+func (a *bearerAuth) authorize(req *http.Request) {
+	if sameHost(req.URL, a.host) {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+}
+
+// formLogin logs in by submitting a site's login form, and then relies on the session
+// cookie it gets back
+type formLogin struct {
+	url    *url.URL   // the page with the login form on it
+	fields url.Values // the fields to fill in, i.e. username and password
+}
+
+// NewFormLogin returns an Authenticator which logs in by filling in fields on the login form at
+// u before the crawl starts
+func NewFormLogin(u *url.URL, fields url.Values) Authenticator {
+	return &formLogin{url: u, fields: fields}
+}
+
+// login implements Authenticator. it GETs the login page so we have any cookies and hidden
+// fields (like a CSRF token) it comes with, then POSTs the form back with our fields filled in.
+func (a *formLogin) login(ctx context.Context, c *crawler) error {
+	resp, err := c.fetch(ctx, http.MethodGet, a.url, nil)
+	if err != nil {
+		return err
+	}
+	action, values, _ := parseLoginForm(resp.Body)
+	resp.Body.Close()
+
+	// post the form to wherever it says, or back to the login page if it doesn't say
+	target := a.url
+	if action != "" {
+		if target, err = a.url.Parse(action); err != nil {
+			return err
+		}
+	}
+	post := make(url.Values)
+	for k, v := range values {
+		post[k] = v
+	}
+	for k, v := range a.fields {
+		post[k] = v
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), strings.NewReader(post.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	before := cookieString(c.client.Jar.Cookies(target))
+	resp, err = c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// a successful login usually redirects somewhere, but a 200 is fine too, as long as it
+	// isn't the login form again and we got a session out of it
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%w: %v", errLoginFailed, resp.Status)
+	}
+	if againAction, againValues, ok := parseLoginForm(resp.Body); ok && againAction == action && sameKeys(againValues, values) {
+		return fmt.Errorf("%w: got the login form back", errLoginFailed)
+	}
+	if cookieString(c.client.Jar.Cookies(target)) == before {
+		return fmt.Errorf("%w: no session cookie was set", errLoginFailed)
+	}
+	return nil
+}
+
+// cookieString returns cookies as they'd be sent in a Cookie header, so we can tell whether
+// they've changed
+func cookieString(cookies []*http.Cookie) string {
+	var s []string
+	for _, c := range cookies {
+		s = append(s, c.String())
+	}
+	return strings.Join(s, "; ")
+}
+
+// sameKeys returns whether a and b have the same fields, whatever their values
+func sameKeys(a, b url.Values) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// authorize implements Authenticator, the cookie jar does the work for a form login
+func (a *formLogin) authorize(req *http.Request) {}
+
+// parseLoginForm returns the action of the first <form> in the HTML in r, the names and
+// values of the inputs in it which have values, and whether there was a form at all
+func parseLoginForm(r io.Reader) (string, url.Values, bool) {
+	values := make(url.Values)
+	action := ""
+	inForm := false
+	z := newTokenizer(r)
+	for {
+		t, err := z.next()
+		if err != nil {
+			return action, values, inForm
+		}
+		switch {
+		case t.typ == tokStartTag && t.data == "form":
+			action, _ = t.attr("action")
+			inForm = true
+		case t.typ == tokEndTag && t.data == "form" && inForm:
+			return action, values, true
+		case (t.typ == tokStartTag || t.typ == tokSelfClosingTag) && t.data == "input" && inForm:
+			name, _ := t.attr("name")
+			value, ok := t.attr("value")
+			typ, _ := t.attr("type")
+			if name != "" && ok && !strings.EqualFold(typ, "submit") {
+				values.Set(name, value)
+			}
+		}
+	}
+}
+
+// authTransport is an http.RoundTripper which adds credentials to requests
+type authTransport struct {
+	next  http.RoundTripper
+	auths []Authenticator
+}
+
+// RoundTrip implements http.RoundTripper
+func (at *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper mustn't change the request it was given, so change a copy
+	req = req.Clone(req.Context())
+	for _, a := range at.auths {
+		a.authorize(req)
+	}
+	return at.next.RoundTrip(req)
+}
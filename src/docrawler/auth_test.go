@@ -0,0 +1,187 @@
+package docrawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// protectedSite serves a two page site to requests which ok says are authorized
+func protectedSite(ok func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ok(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/">home</a> <a href="/secret.html">secret</a>`))
+	}))
+}
+
+// TestHeaderAuth verifies we can crawl sites behind basic auth or a bearer token, but only
+// when the credentials are for the right host
+func TestHeaderAuth(t *testing.T) {
+	basic := protectedSite(func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "docs" && pass == "p@ss:word"
+	})
+	defer basic.Close()
+	bearer := protectedSite(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer s3cret"
+	})
+	defer bearer.Close()
+	host := func(ts *httptest.Server) string { return strings.TrimPrefix(ts.URL, "http://") }
+
+	tests := []struct {
+		ts    *httptest.Server
+		auth  Authenticator
+		pages int
+	}{
+		{basic, NewBasicAuth(host(basic), "docs", "p@ss:word"), 2},
+		{basic, NewBasicAuth(host(bearer), "docs", "p@ss:word"), 0},
+		{bearer, NewBearerAuth(host(bearer), "s3cret"), 2},
+		{bearer, NewBearerAuth(host(basic), "s3cret"), 0},
+	}
+	for _, test := range tests {
+		pages := crawlPages(t, context.Background(), test.ts.URL+"/", Options{Workers: 2, IgnoreRobots: true, Auths: []Authenticator{test.auth}})
+		if l := sitemapToLocations(pages); len(l) != test.pages {
+			t.Errorf("%+v: got %v pages, wanted %v", test.auth, len(l), test.pages)
+		}
+	}
+}
+
+// TestAuthNotSentRemote verifies that credentials only go to the host they're for
+func TestAuthNotSentRemote(t *testing.T) {
+	var got http.Header
+	at := &authTransport{
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			got = req.Header
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		auths: []Authenticator{
+			NewBasicAuth("docs.example.com", "u", "p"),
+			NewBearerAuth("api.example.com", "t"),
+		},
+	}
+	for rawurl, want := range map[string]string{
+		"http://docs.example.com/":         "Basic dTpw",
+		"http://DOCS.example.com/a":        "Basic dTpw",
+		"https://api.example.com/x":        "Bearer t",
+		"http://example.com/":              "",
+		"http://docs.example.com:8080/":    "",
+		"http://evil.com/docs.example.com": "",
+	} {
+		req, err := http.NewRequest(http.MethodGet, rawurl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := at.RoundTrip(req); err != nil {
+			t.Fatal(err)
+		}
+		if auth := got.Get("Authorization"); auth != want {
+			t.Errorf("%v: got Authorization %q, wanted %q", rawurl, auth, want)
+		}
+		if req.Header.Get("Authorization") != "" {
+			t.Errorf("%v: the original request was changed", rawurl)
+		}
+	}
+}
+
+// roundTripFunc is an http.RoundTripper which is just a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestFormLogin verifies we can log in with a form, including a CSRF token, and crawl with
+// the session we get back
+func TestFormLogin(t *testing.T) {
+	const form = `<form method="post" action="/session">
+		<input type="hidden" name="csrf" value="tok">
+		<input name="user"><input type="password" name="pass">
+		<input type="submit" name="go" value="Log in">
+		</form>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Path == "/login" && r.Method == http.MethodGet:
+			http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "tok"})
+			w.Write([]byte(form))
+		case r.URL.Path == "/session" && r.Method == http.MethodPost:
+			c, err := r.Cookie("csrf")
+			switch {
+			case r.PostFormValue("pass") == "again":
+				// some sites just show the form again, with a 200 (and maybe a cookie)
+				http.SetCookie(w, &http.Cookie{Name: "flash", Value: "wrong"})
+				w.Write([]byte(`<p>Wrong password</p>` + form))
+				return
+			case r.PostFormValue("pass") == "nocookie":
+				w.Write([]byte(`<p>Welcome!</p>`))
+				return
+			case err != nil || c.Value != r.PostFormValue("csrf") || r.PostFormValue("go") != "" ||
+				r.PostFormValue("user") != "docs" || r.PostFormValue("pass") != "hunter2":
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			if c, err := r.Cookie("session"); err != nil || c.Value != "ok" {
+				http.Redirect(w, r, "/login", http.StatusFound)
+				return
+			}
+			w.Write([]byte(`<a href="/">home</a> <a href="/secret.html">secret</a>`))
+		}
+	}))
+	defer ts.Close()
+	loginURL, err := url.Parse(ts.URL + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		password string
+		pages    int
+	}{
+		{"hunter2", 2},
+		{"wrong", -1},
+		{"again", -1},
+		{"nocookie", -1},
+	} {
+		fields := url.Values{"user": {"docs"}, "pass": {test.password}}
+		opts := Options{Workers: 2, IgnoreRobots: true, Auths: []Authenticator{NewFormLogin(loginURL, fields)}}
+		pages, _, err := doCrawl(context.Background(), ts.URL+"/", opts)
+		if test.pages < 0 {
+			if !errors.Is(err, errLoginFailed) {
+				t.Errorf("got %v with a bad login, wanted %v", err, errLoginFailed)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := sitemapToLocations(pages)
+		if len(l) != test.pages || l[1].URL != ts.URL+"/secret.html" {
+			t.Errorf("got %+v", l)
+		}
+	}
+}
+
+// TestParseLoginForm verifies we find a form's action and prefilled fields
+func TestParseLoginForm(t *testing.T) {
+	action, values, ok := parseLoginForm(strings.NewReader(`<input name="outside" value="x">
+		<form action="/go"><input name="a" value="1"><input name="b"><input type=SUBMIT name=s value=go>
+		<input name="c" value="a &amp; b"/></form><form><input name="d" value="2"></form>`))
+	if !ok || action != "/go" || values.Encode() != "a=1&c=a+%26+b" {
+		t.Errorf("got %q, %v, %v", action, values, ok)
+	}
+	if _, _, ok := parseLoginForm(strings.NewReader(`<p>no form here</p>`)); ok {
+		t.Error("found a form that isn't there")
+	}
+}
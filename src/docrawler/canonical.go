@@ -0,0 +1,73 @@
+package docrawler
+
+import "net/url"
+
+// relCanonical is the rel of a <link> which says where a page really is
+const relCanonical = "canonical"
+
+// canonical findings, reported for canonical links which a site should probably fix
+const (
+	findingCanonicalOffSite  = "off-site" // the canonical is out of scope, i.e. on another host
+	findingCanonicalBroken   = "broken"   // the canonical doesn't work
+	findingCanonicalRedirect = "redirect" // the canonical redirects somewhere else
+	findingCanonicalChain    = "chain"    // the canonical declares a different canonical of its own
+)
+
+// resolveCanonicals points every page which declared a canonical URL at the item it refers
+// to, and notes anything wrong with it. if merge is set, each page whose canonical is another
+// page we crawled (and which has nothing wrong with it) is folded into that page as an alias.
+func resolveCanonicals(crawled, crawledStripped itemMap, norm *normalizer, merge bool) {
+	var pages itemSlice
+	seen := make(map[*httpItem]bool)
+	for _, item := range crawled {
+		if seen[item] || item.linkType != tHTMLPage || item.duplicate || item.canonical == nil {
+			continue
+		}
+		seen[item] = true
+		pages = append(pages, item)
+	}
+
+	// find every canonical first, since whether one is a chain depends on the others
+	for _, item := range pages {
+		if norm.strippedKey(item.canonical) == norm.strippedKey(item.finalURL()) {
+			continue // it's its own canonical, which is fine
+		}
+		target, ok := crawled[norm.key(item.canonical)]
+		if !ok {
+			target = crawledStripped[norm.strippedKey(item.canonical)]
+		}
+		item.canonicalItem = target
+	}
+
+	for _, item := range pages {
+		target := item.canonicalItem
+		if target == nil {
+			continue
+		}
+		item.canonicalFindings = canonicalFindings(item.canonical, target, norm)
+		if merge && len(item.canonicalFindings) == 0 && target.linkType == tHTMLPage && !target.duplicate {
+			item.duplicate = true
+			item.mergedInto = target
+			target.aliases = append(target.aliases, item.finalURL())
+		}
+	}
+}
+
+// canonicalFindings returns any problems with canonical, which refers to target
+func canonicalFindings(canonical *url.URL, target *httpItem, norm *normalizer) []string {
+	var findings []string
+	if target.scope.out {
+		findings = append(findings, findingCanonicalOffSite)
+	}
+	if target.linkType == tBroken {
+		findings = append(findings, findingCanonicalBroken)
+	}
+	// target is where we ended up, so it only redirected if that's not where canonical is
+	if norm.strippedKey(canonical) != norm.strippedKey(target.finalURL()) {
+		findings = append(findings, findingCanonicalRedirect)
+	}
+	if target.canonicalItem != nil && target.canonicalItem != target {
+		findings = append(findings, findingCanonicalChain)
+	}
+	return findings
+}
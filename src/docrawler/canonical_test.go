@@ -0,0 +1,93 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestCrawlCanonical checks canonicals are recorded and checked, and merged if we ask
+func TestCrawlCanonical(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer other.Close()
+	canonicals := map[string]string{
+		"/a":       "/a",
+		"/a?ref=x": "/a",
+		"/b":       "/old",
+		"/c":       other.URL + "/c",
+		"/d":       "/missing",
+		"/e":       "/f",
+		"/f":       "/a",
+	}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if canonical, ok := canonicals[r.URL.RequestURI()]; ok {
+			w.Write([]byte(`<link rel="canonical" href="` + canonical + `">`))
+		}
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/a">a</a> <a href="/a?ref=x">a</a> <a href="/b">b</a> <a href="/c">c</a>
+				<a href="/d">d</a> <a href="/e">e</a>`))
+		}
+	}))
+	defer site.Close()
+
+	findings := func(merge bool) (map[string][]string, map[string]*Location) {
+		opts := Options{Workers: 4, IgnoreRobots: true, MergeCanonical: merge}
+		got := make(map[string][]string)
+		locations := make(map[string]*Location)
+		for _, l := range sitemapToLocations(crawlPages(t, context.Background(), site.URL+"/", opts)) {
+			if l.Canonical != "" {
+				got[l.URL[len(site.URL):]] = l.CanonicalFindings
+			}
+			locations[l.URL[len(site.URL):]] = l
+		}
+		return got, locations
+	}
+
+	got, locations := findings(false)
+	want := map[string][]string{
+		"/a":       nil,
+		"/a?ref=x": nil,
+		"/b":       {findingCanonicalRedirect},
+		"/c":       {findingCanonicalOffSite},
+		"/d":       {findingCanonicalBroken},
+		"/e":       {findingCanonicalChain},
+		"/f":       nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got findings %v, wanted %v", got, want)
+	}
+	if l := locations["/b"]; l == nil || l.Canonical != site.URL+"/old" {
+		t.Errorf("got location %+v, wanted canonical %v", l, site.URL+"/old")
+	}
+
+	// merged, /a?ref=x and /f are folded into /a, and /e isn't, since its canonical wasn't /a
+	_, locations = findings(true)
+	if _, ok := locations["/a?ref=x"]; ok {
+		t.Error("duplicate was still listed after merging")
+	}
+	if _, ok := locations["/f"]; ok {
+		t.Error("duplicate was still listed after merging")
+	}
+	if _, ok := locations["/e"]; !ok {
+		t.Error("page with a canonical chain was merged")
+	}
+	if a := locations["/a"]; a == nil || !reflect.DeepEqual(a.Aliases, []string{site.URL + "/a?ref=x", site.URL + "/f"}) {
+		t.Errorf("got %+v, wanted aliases", a)
+	}
+	if home := locations["/"]; home == nil || !reflect.DeepEqual(home.Links, []string{site.URL + "/a", site.URL + "/b", site.URL + "/c", site.URL + "/d", site.URL + "/e"}) {
+		t.Errorf("got home %+v, wanted links to merged pages to be their canonical", home)
+	}
+}
@@ -0,0 +1,181 @@
+package docrawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// defaultUserAgent is the User-Agent we send unless told otherwise. its product token is
+// robotsUserAgent, so sites can address us in their robots.txt
+const defaultUserAgent = robotsUserAgent + "/1.0"
+
+// custom errors
+var (
+	errNoCertificates = errors.New("no certificates found in CA bundle")
+)
+
+// ClientOptions holds everything configurable about the http client we crawl with
+type ClientOptions struct {
+	ConnectTimeout time.Duration  // how long to wait for a connection (and TLS handshake), 0 for no limit
+	ReadTimeout    time.Duration  // how long to wait for each read from a connection, 0 for no limit
+	RequestTimeout time.Duration  // how long a whole request may take, including its body, 0 for no limit
+	Proxy          *url.URL       // proxy to send every request through, or nil to use the environment's
+	RootCAs        *x509.CertPool // CAs to trust, or nil for the system's
+	Insecure       bool           // don't verify TLS certificates at all
+	UserAgent      string         // User-Agent header, or empty for none
+	Header         http.Header    // extra headers sent with every request to the site we're crawling
+	Cookies        []*http.Cookie // extra cookies sent with every request to the site we're crawling
+}
+
+// DefaultClientOptions returns the client options we use if nothing else is specified
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		ConnectTimeout: 10 * time.Second,
+		ReadTimeout:    30 * time.Second,
+		RequestTimeout: 2 * time.Minute,
+		UserAgent:      defaultUserAgent,
+	}
+}
+
+// newTransport returns an http.RoundTripper which makes requests as configured by opts. our
+// extra headers and cookies are only sent to URLs onSite says are part of the site.
+func newTransport(opts ClientOptions, onSite func(*url.URL) bool) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	t.DialContext = dialer.DialContext
+	if opts.ReadTimeout > 0 {
+		t.DialContext = (&deadlineDialer{dialer: dialer, timeout: opts.ReadTimeout}).DialContext
+	}
+	t.TLSHandshakeTimeout = opts.ConnectTimeout
+	if opts.Proxy != nil {
+		t.Proxy = http.ProxyURL(opts.Proxy)
+	}
+	t.TLSClientConfig = &tls.Config{RootCAs: opts.RootCAs, InsecureSkipVerify: opts.Insecure}
+
+	var rt http.RoundTripper = t
+	if opts.RequestTimeout > 0 {
+		rt = &timeoutTransport{next: rt, timeout: opts.RequestTimeout}
+	}
+	if opts.UserAgent != "" || len(opts.Header) > 0 || len(opts.Cookies) > 0 {
+		rt = &headerTransport{next: rt, userAgent: opts.UserAgent, header: opts.Header, cookies: opts.Cookies, onSite: onSite}
+	}
+	return rt
+}
+
+// timeoutTransport is an http.RoundTripper which gives each request (including reading its
+// body) at most timeout to finish. unlike http.Client.Timeout, this doesn't count any time
+// spent waiting on our throttle
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip implements http.RoundTripper
+func (tt *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), tt.timeout)
+	resp, err := tt.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody is a response body which cancels its request's context once it's closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// headerTransport is an http.RoundTripper which adds our User-Agent to every request, and our
+// extra headers and cookies to those for the site we're crawling. like credentials, they may
+// well be secrets, so remote hosts never get them.
+type headerTransport struct {
+	next      http.RoundTripper
+	userAgent string
+	header    http.Header
+	cookies   []*http.Cookie
+	onSite    func(*url.URL) bool
+}
+
+// RoundTrip implements http.RoundTripper
+func (ht *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper mustn't change the request it was given, so change a copy
+	req = req.Clone(req.Context())
+	if ht.userAgent != "" {
+		req.Header.Set("User-Agent", ht.userAgent)
+	}
+	if !ht.onSite(req.URL) {
+		return ht.next.RoundTrip(req)
+	}
+	for k, v := range ht.header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	for _, c := range ht.cookies {
+		req.AddCookie(c)
+	}
+	return ht.next.RoundTrip(req)
+}
+
+// deadlineDialer dials connections which time out if any single read takes longer than
+// timeout, so a server which stalls part way through a response can't hang a worker
+type deadlineDialer struct {
+	dialer  *net.Dialer
+	timeout time.Duration
+}
+
+// DialContext has the same signature as net.Dialer.DialContext
+func (d *deadlineDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &deadlineConn{Conn: conn, timeout: d.timeout}, nil
+}
+
+// deadlineConn is a net.Conn which pushes its read deadline back before every read
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// Read implements io.Reader
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// LoadCABundle reads a PEM file of CA certificates to trust, in addition to the system's
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%v: %w", path, errNoCertificates)
+	}
+	return pool, nil
+}
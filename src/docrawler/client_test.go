@@ -0,0 +1,197 @@
+package docrawler
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// get makes a single GET with a client configured by opts
+func get(t *testing.T, opts ClientOptions, rawurl string) (*http.Response, error) {
+	t.Helper()
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCrawler(Options{Client: opts})
+	return c.fetch(context.Background(), http.MethodGet, u, nil)
+}
+
+// TestClientHeaders verifies that our User-Agent, extra headers and cookies are sent
+func TestClientHeaders(t *testing.T) {
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer ts.Close()
+
+	opts := DefaultClientOptions()
+	opts.Header = http.Header{"X-Team": {"docs"}, "Accept-Language": {"en"}}
+	opts.Cookies = []*http.Cookie{{Name: "session", Value: "abc"}, {Name: "theme", Value: "dark"}}
+
+	resp, err := get(t, opts, ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if ua := got.Header.Get("User-Agent"); ua != defaultUserAgent {
+		t.Errorf("got User-Agent %q", ua)
+	}
+	if got.Header.Get("X-Team") != "docs" || got.Header.Get("Accept-Language") != "en" {
+		t.Errorf("got headers %v", got.Header)
+	}
+	if c, err := got.Cookie("theme"); err != nil || c.Value != "dark" {
+		t.Errorf("got cookies %v", got.Cookies())
+	}
+}
+
+// TestClientHeadersRemote verifies that our extra headers and cookies aren't sent to remote
+// hosts when we check links to them
+func TestClientHeadersRemote(t *testing.T) {
+	var mu sync.Mutex
+	var got []*http.Request
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer remote.Close()
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Team") != "docs" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="` + remote.URL + `/page.html">remote</a>`))
+	}))
+	defer site.Close()
+
+	opts := Options{Workers: 2, RemoteWorkers: 1, CheckRemote: true, Client: DefaultClientOptions()}
+	opts.Client.Header = http.Header{"X-Team": {"docs"}}
+	opts.Client.Cookies = []*http.Cookie{{Name: "session", Value: "abc"}}
+	l := sitemapToLocations(crawlPages(t, context.Background(), site.URL+"/", opts))
+	if len(l) != 1 || len(l[0].Remote) != 1 {
+		t.Fatalf("got %+v", l)
+	}
+	if len(got) == 0 {
+		t.Fatal("remote link wasn't checked")
+	}
+	for _, r := range got {
+		if r.Header.Get("X-Team") != "" || len(r.Cookies()) > 0 {
+			t.Errorf("%v %v got headers %v", r.Method, r.URL, r.Header)
+		}
+		if r.Header.Get("User-Agent") != defaultUserAgent {
+			t.Errorf("%v %v got User-Agent %q", r.Method, r.URL, r.Header.Get("User-Agent"))
+		}
+	}
+}
+
+// TestClientTimeouts verifies that a server which stalls can't hang a request
+func TestClientTimeouts(t *testing.T) {
+	stall := make(chan struct{})
+	defer close(stall)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// send the headers and part of the body, then stall
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stall:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+
+	for _, opts := range []ClientOptions{
+		{ReadTimeout: 100 * time.Millisecond},
+		{RequestTimeout: 100 * time.Millisecond},
+	} {
+		resp, err := get(t, opts, ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		_, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil || classifyError(err) != classTimeout {
+			t.Errorf("%+v: got %v, wanted a timeout", opts, err)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%+v: took too long to time out", opts)
+		}
+	}
+}
+
+// TestClientTLS verifies that we can trust a custom CA, or skip verification altogether
+func TestClientTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// the test server's certificate isn't trusted by default
+	if _, err := get(t, ClientOptions{}, ts.URL); classifyError(err) != classTLS {
+		t.Errorf("got %v, wanted a TLS error", err)
+	}
+
+	// but is if we say so
+	if resp, err := get(t, ClientOptions{Insecure: true}, ts.URL); err != nil {
+		t.Error(err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// or if we trust its certificate
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := LoadCABundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := get(t, ClientOptions{RootCAs: pool}, ts.URL); err != nil {
+		t.Error(err)
+	} else {
+		resp.Body.Close()
+	}
+
+	// a bundle without any certificates in it is an error
+	if err := ioutil.WriteFile(path, []byte("nothing here"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCABundle(path); err == nil {
+		t.Error("expected an error for an empty bundle")
+	}
+	if _, err := LoadCABundle(filepath.Join(t.TempDir(), "missing.pem")); !os.IsNotExist(err) {
+		t.Errorf("got %v for a missing bundle", err)
+	}
+}
+
+// TestClientProxy verifies that requests go through our proxy
+func TestClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+	u, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := get(t, ClientOptions{Proxy: u}, "http://doesntexist23492387492837492374982734.com/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://doesntexist23492387492837492374982734.com/page" {
+		t.Errorf("proxy got %q", proxied)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// loadConfig reads a JSON config file, an object of flag names (without the leading '-') and
+// their values, i.e. {"rps": 2, "header": ["X-Team: docs"]}. an array sets a repeatable flag
+// once per element. flags which were already set on the command line win over the file.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// keep numbers as they were written, so they parse exactly as they would on the command line
+	var config map[string]interface{}
+	d := json.NewDecoder(f)
+	d.UseNumber()
+	if err := d.Decode(&config); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for name, value := range config {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%v: unknown flag %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			if err := fs.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%v: flag %q: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
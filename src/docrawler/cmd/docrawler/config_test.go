@@ -0,0 +1,59 @@
+package main
+
+import (
+	"docrawler"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadConfig verifies that a config file sets flags, but not over the command line
+func TestLoadConfig(t *testing.T) {
+	opts := docrawler.DefaultOptions()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Float64Var(&opts.RPS, "rps", opts.RPS, "")
+	fs.IntVar(&opts.Burst, "burst", opts.Burst, "")
+	fs.BoolVar(&opts.Client.Insecure, "insecure", opts.Client.Insecure, "")
+	fs.DurationVar(&opts.Client.ReadTimeout, "read-timeout", opts.Client.ReadTimeout, "")
+	fs.StringVar(&opts.Client.UserAgent, "user-agent", opts.Client.UserAgent, "")
+	fs.Var(headerFlag{&opts.Client.Header}, "header", "")
+	if err := fs.Parse([]string{"-burst", "5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{
+		"rps": 2.5,
+		"burst": 3,
+		"insecure": true,
+		"read-timeout": "5s",
+		"user-agent": "test/1.0",
+		"header": ["X-A: 1", "X-B: 2"]
+	}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if opts.RPS != 2.5 || opts.Burst != 5 || !opts.Client.Insecure || opts.Client.ReadTimeout != 5*time.Second {
+		t.Errorf("got %+v", opts)
+	}
+	if opts.Client.UserAgent != "test/1.0" || opts.Client.Header.Get("X-A") != "1" || opts.Client.Header.Get("X-B") != "2" {
+		t.Errorf("got client %+v", opts.Client)
+	}
+
+	// unknown flags, bad values and bad JSON are all errors
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Float64Var(&opts.RPS, "rps", opts.RPS, "")
+	for _, bad := range []string{`{"nope": 1}`, `{"rps": "fast"}`, `{"rps":`} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadConfig(fs, path); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"docrawler"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// diff output formats
+const (
+	diffFormatText = "text"
+	diffFormatJSON = "json"
+)
+
+// diffCommand runs "docrawler diff [options] old.json new.json", writing the diff to w, and
+// returns the exit status
+func diffCommand(args []string, w io.Writer, errw io.Writer) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(errw)
+	format := fs.String("format", diffFormatText, "output format: text or json")
+	fs.Usage = func() {
+		fmt.Fprintf(errw, "usage: docrawler diff [options] old.json new.json\n\noptions:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 || (*format != diffFormatText && *format != diffFormatJSON) {
+		fs.Usage()
+		return 2
+	}
+
+	before, err := docrawler.LoadLocations(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(errw, "unable to load site map: %v\n", err)
+		return 1
+	}
+	after, err := docrawler.LoadLocations(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(errw, "unable to load site map: %v\n", err)
+		return 1
+	}
+
+	d := docrawler.Diff(before, after)
+	if *format == diffFormatJSON {
+		b, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			fmt.Fprintf(errw, "unable to output diff: %v\n", err)
+			return 1
+		}
+		fmt.Fprintln(w, string(b))
+		return 0
+	}
+	fmt.Fprint(w, d.Text())
+	return 0
+}
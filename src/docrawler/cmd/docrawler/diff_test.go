@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"docrawler"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDiffCommand checks the diff subcommand reads site maps, writes both formats, and exits
+// with the right status when it can't
+func TestDiffCommand(t *testing.T) {
+	dir := t.TempDir()
+	for name, j := range map[string]string{
+		"old.json": `[{"URL": "http://a.com/", "Title": "Home", "Links": ["http://a.com/old"]}, {"URL": "http://a.com/old"}]`,
+		"new.json": `[{"URL": "http://a.com/", "Title": "Home Page", "Links": ["http://a.com/new"]}, {"URL": "http://a.com/new"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(j), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := []string{filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")}
+
+	var out, errs bytes.Buffer
+	if status := diffCommand(paths, &out, &errs); status != 0 {
+		t.Fatalf("got status %v: %v", status, errs.String())
+	}
+	if !strings.HasPrefix(out.String(), "Added pages (1):\n  + http://a.com/new\n") {
+		t.Errorf("got:\n%v", out.String())
+	}
+
+	out.Reset()
+	if status := diffCommand(append([]string{"-format=json"}, paths...), &out, &errs); status != 0 {
+		t.Fatalf("got status %v: %v", status, errs.String())
+	}
+	var d docrawler.SiteDiff
+	if err := json.Unmarshal(out.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+	want := &docrawler.SiteDiff{
+		Added:   []string{"http://a.com/new"},
+		Removed: []string{"http://a.com/old"},
+		Titles:  []docrawler.TitleChange{{URL: "http://a.com/", Old: "Home", New: "Home Page"}},
+		Links:   []docrawler.LinkChange{{URL: "http://a.com/", Added: []string{"http://a.com/new"}, Removed: []string{"http://a.com/old"}}},
+	}
+	if !reflect.DeepEqual(&d, want) {
+		t.Errorf("got %+v from json output", d)
+	}
+
+	for _, test := range []struct {
+		args   []string
+		status int
+	}{
+		{paths[:1], 2},
+		{append([]string{"-format=xml"}, paths...), 2},
+		{[]string{paths[0], filepath.Join(dir, "missing.json")}, 1},
+	} {
+		if status := diffCommand(test.args, &out, &errs); status != test.status {
+			t.Errorf("%v: got status %v, wanted %v", test.args, status, test.status)
+		}
+	}
+}
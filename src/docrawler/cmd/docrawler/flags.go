@@ -0,0 +1,194 @@
+package main
+
+import (
+	"docrawler"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// custom errors
+var (
+	errBadHeader = errors.New(`header must be "Name: value"`)
+	errBadAuth   = errors.New(`must be "credentials@host"`)
+	errBadField  = errors.New(`field must be "name=value"`)
+)
+
+// headerFlag is a flag.Value which collects repeated "Name: value" flags into an http.Header
+type headerFlag struct {
+	header *http.Header
+}
+
+// String implements flag.Value
+func (f headerFlag) String() string {
+	if f.header == nil {
+		return ""
+	}
+	var lines []string
+	for k, v := range *f.header {
+		for _, v := range v {
+			lines = append(lines, k+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, ", ")
+}
+
+// Set implements flag.Value
+func (f headerFlag) Set(value string) error {
+	i := strings.Index(value, ":")
+	if i <= 0 {
+		return errBadHeader
+	}
+	if *f.header == nil {
+		*f.header = make(http.Header)
+	}
+	f.header.Add(strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:]))
+	return nil
+}
+
+// cookieFlag is a flag.Value which collects repeated "name=value" flags into cookies
+type cookieFlag struct {
+	cookies *[]*http.Cookie
+}
+
+// String implements flag.Value
+func (f cookieFlag) String() string {
+	if f.cookies == nil {
+		return ""
+	}
+	var cookies []string
+	for _, c := range *f.cookies {
+		cookies = append(cookies, c.String())
+	}
+	return strings.Join(cookies, "; ")
+}
+
+// Set implements flag.Value. like a Cookie header, one flag may hold several "; " separated cookies
+func (f cookieFlag) Set(value string) error {
+	cookies, err := http.ParseCookie(value)
+	if err != nil {
+		return err
+	}
+	*f.cookies = append(*f.cookies, cookies...)
+	return nil
+}
+
+// splitAuth splits a "credentials@host" flag value
+func splitAuth(value string) (string, string, error) {
+	i := strings.LastIndex(value, "@")
+	if i <= 0 || i == len(value)-1 {
+		return "", "", errBadAuth
+	}
+	return value[:i], value[i+1:], nil
+}
+
+// basicAuthFlag is a flag.Value which adds a basicAuth for each "user:password@host"
+type basicAuthFlag struct {
+	auths *[]docrawler.Authenticator
+}
+
+// String implements flag.Value, without giving away any passwords
+func (f basicAuthFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (f basicAuthFlag) Set(value string) error {
+	creds, host, err := splitAuth(value)
+	if err != nil {
+		return err
+	}
+	username, password, _ := strings.Cut(creds, ":")
+	*f.auths = append(*f.auths, docrawler.NewBasicAuth(host, username, password))
+	return nil
+}
+
+// bearerAuthFlag is a flag.Value which adds a bearerAuth for each "token@host"
+type bearerAuthFlag struct {
+	auths *[]docrawler.Authenticator
+}
+
+// String implements flag.Value, without giving away any tokens
+func (f bearerAuthFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (f bearerAuthFlag) Set(value string) error {
+	token, host, err := splitAuth(value)
+	if err != nil {
+		return err
+	}
+	*f.auths = append(*f.auths, docrawler.NewBearerAuth(host, token))
+	return nil
+}
+
+// fieldsFlag is a flag.Value which collects repeated "name=value" flags into url.Values
+type fieldsFlag struct {
+	fields url.Values
+}
+
+// String implements flag.Value, without giving away any passwords
+func (f fieldsFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value
+func (f fieldsFlag) Set(value string) error {
+	name, v, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return errBadField
+	}
+	f.fields.Add(name, v)
+	return nil
+}
+
+// regexpsFlag is a flag.Value which collects repeated regular expression flags
+type regexpsFlag struct {
+	res *[]*regexp.Regexp
+}
+
+// String implements flag.Value
+func (f regexpsFlag) String() string {
+	if f.res == nil {
+		return ""
+	}
+	var exprs []string
+	for _, re := range *f.res {
+		exprs = append(exprs, re.String())
+	}
+	return strings.Join(exprs, ", ")
+}
+
+// Set implements flag.Value
+func (f regexpsFlag) Set(value string) error {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f.res = append(*f.res, re)
+	return nil
+}
+
+// stringsFlag is a flag.Value which collects repeated string flags
+type stringsFlag struct {
+	strs *[]string
+}
+
+// String implements flag.Value
+func (f stringsFlag) String() string {
+	if f.strs == nil {
+		return ""
+	}
+	return strings.Join(*f.strs, ", ")
+}
+
+// Set implements flag.Value
+func (f stringsFlag) Set(value string) error {
+	*f.strs = append(*f.strs, value)
+	return nil
+}
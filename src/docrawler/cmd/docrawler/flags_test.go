@@ -0,0 +1,72 @@
+package main
+
+import (
+	"docrawler"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// TestHeaderFlags verifies that repeated -header and -cookie flags collect up, and print back
+func TestHeaderFlags(t *testing.T) {
+	opts := docrawler.DefaultClientOptions()
+	headers := headerFlag{&opts.Header}
+	cookies := cookieFlag{&opts.Cookies}
+	for _, err := range []error{
+		headers.Set("X-Team: docs"),
+		headers.Set("Accept-Language: en"),
+		cookies.Set("session=abc; theme=dark"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := headers.Set("no colon"); err == nil {
+		t.Error("expected an error for a bad header")
+	}
+	if opts.Header.Get("X-Team") != "docs" || len(opts.Cookies) != 2 {
+		t.Errorf("got header %v and cookies %v", opts.Header, opts.Cookies)
+	}
+	if headers.String() != "Accept-Language: en, X-Team: docs" || cookies.String() != "session=abc; theme=dark" {
+		t.Errorf("got flags %q and %q", headers.String(), cookies.String())
+	}
+}
+
+// TestAuthFlags verifies that -basic-auth and -bearer-token add authenticators for the right
+// hosts, and reject values without one
+func TestAuthFlags(t *testing.T) {
+	var auths []docrawler.Authenticator
+	if err := (basicAuthFlag{&auths}).Set("docs:p@ss:word@docs.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := (bearerAuthFlag{&auths}).Set("s3cret@api.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	want := []docrawler.Authenticator{
+		docrawler.NewBasicAuth("docs.example.com", "docs", "p@ss:word"),
+		docrawler.NewBearerAuth("api.example.com", "s3cret"),
+	}
+	if !reflect.DeepEqual(auths, want) {
+		t.Errorf("got %+v, wanted %+v", auths, want)
+	}
+
+	// bad flags
+	for _, bad := range []string{"nohost", "@host", "creds@"} {
+		if err := (basicAuthFlag{&auths}).Set(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// TestFieldsFlag verifies that repeated -login-field flags collect up
+func TestFieldsFlag(t *testing.T) {
+	fields := fieldsFlag{make(url.Values)}
+	fields.Set("user=docs")
+	fields.Set("pass=a=b")
+	if fields.fields.Encode() != "pass=a%3Db&user=docs" {
+		t.Errorf("got %v", fields.fields)
+	}
+	if err := fields.Set("novalue"); err == nil {
+		t.Error("expected an error for a field without a value")
+	}
+}
@@ -0,0 +1,182 @@
+// Command docrawler crawls a site and outputs its site map. see the docrawler package for the
+// crawler itself.
+package main
+
+import (
+	"context"
+	"docrawler"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+)
+
+// main is our program's entry point
+func main() {
+	// our banner goes to stderr, so stdout is just the output (and can be piped to dot, etc.)
+	fmt.Fprintf(os.Stderr, "\nD.O. Crawler 1.0  Copyright (c) 2015 Stephen Waits <steve@waits.net>  2015-02-17\n\n")
+
+	// "docrawler diff old.json new.json" compares two site maps, rather than crawling
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(diffCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// parse our flags
+	opts := docrawler.DefaultOptions()
+	out := docrawler.DefaultOutputOptions()
+	nWorkers := flag.Uint("num", uint(opts.Workers), "number of workers")
+	flag.BoolVar(&opts.IgnoreRobots, "ignore-robots", false, "ignore robots.txt")
+	flag.Float64Var(&opts.RPS, "rps", opts.RPS, "maximum requests per second, per host (0 for no limit)")
+	flag.IntVar(&opts.Burst, "burst", opts.Burst, "requests per host allowed back to back before -rps applies")
+	flag.DurationVar(&opts.MinDelay, "delay", opts.MinDelay, "minimum delay between requests to the same host")
+	flag.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "maximum time to spend crawling each URL (0 for no limit)")
+	flag.IntVar(&opts.MaxDepth, "max-depth", opts.MaxDepth, "maximum number of links away from the home page to crawl (0 for no limit)")
+	flag.IntVar(&opts.MaxPages, "max-pages", opts.MaxPages, "maximum number of URLs to crawl (0 for no limit)")
+	flag.BoolVar(&opts.CheckRemote, "check-remote", opts.CheckRemote, "check that links to other hosts work, without crawling them")
+	flag.IntVar(&opts.RemoteWorkers, "remote-num", opts.RemoteWorkers, "with -check-remote, number of remote link checkers (on top of -num)")
+	flag.Var(stringsFlag{&opts.Scope.Hosts}, "host", `also crawl hosts matching this glob, i.e. "*.example.com" (repeatable)`)
+	flag.BoolVar(&opts.Scope.SameWWW, "same-www", opts.Scope.SameWWW, "treat www.host and host as the same host")
+	flag.Var(stringsFlag{&opts.Scope.PathPrefixes}, "path-prefix", "only crawl paths starting with this, i.e. /docs/ (repeatable)")
+	flag.Var(regexpsFlag{&opts.Scope.Include}, "include", "only crawl URLs matching this regular expression (repeatable)")
+	flag.Var(regexpsFlag{&opts.Scope.Exclude}, "exclude", "never crawl URLs matching this regular expression (repeatable)")
+	flag.BoolVar(&opts.Normalize.SortQuery, "sort-query", opts.Normalize.SortQuery, "treat URLs whose query parameters are in a different order as the same page")
+	flag.Var(stringsFlag{&opts.Normalize.StripParams}, "strip-param", `ignore query parameters matching this glob, i.e. "utm_*" (repeatable)`)
+	flag.BoolVar(&opts.Normalize.FoldTrailingSlash, "fold-trailing-slash", opts.Normalize.FoldTrailingSlash, "treat /a/ and /a as the same page")
+	flag.BoolVar(&opts.MergeCanonical, "merge-canonical", opts.MergeCanonical, `merge pages into the page their rel="canonical" points at, listing them as its aliases`)
+	flag.StringVar(&opts.StateDir, "state-dir", opts.StateDir, "directory to keep the crawl's progress in as it runs, so it can be resumed")
+	flag.BoolVar(&opts.Resume, "resume", opts.Resume, "with -state-dir, carry on from where the last crawl got to, without refetching what it finished")
+	flag.StringVar(&opts.PreviousDir, "previous", opts.PreviousDir, "the -state-dir of a previous crawl, to only fetch pages which have changed since and report what did")
+	flag.BoolVar(&opts.UseSitemaps, "use-sitemaps", opts.UseSitemaps, "also crawl pages listed in the site's sitemaps, and report orphans")
+	flag.StringVar(&out.Format, "format", out.Format, "output format: json, ndjson, dot or sitemap")
+	flag.StringVar(&out.SitemapDir, "sitemap-dir", out.SitemapDir, "with -format=sitemap, where to write extra files if the sitemap is split")
+	flag.StringVar(&out.SitemapURL, "sitemap-url", out.SitemapURL, "with -format=sitemap, the URL the sitemap files will be served from (default is the site's root)")
+	flag.IntVar(&out.DOTCluster, "dot-cluster", out.DOTCluster, "with -format=dot, cluster nodes by this many leading path segments (0 for none)")
+	flag.DurationVar(&opts.Client.ConnectTimeout, "connect-timeout", opts.Client.ConnectTimeout, "maximum time to wait for a connection, including the TLS handshake (0 for no limit)")
+	flag.DurationVar(&opts.Client.ReadTimeout, "read-timeout", opts.Client.ReadTimeout, "maximum time to wait on each read from a connection (0 for no limit)")
+	flag.DurationVar(&opts.Client.RequestTimeout, "request-timeout", opts.Client.RequestTimeout, "maximum time for a single request, including its body (0 for no limit)")
+	proxy := flag.String("proxy", "", "HTTP(S) proxy URL to send every request through (default is from $HTTP_PROXY etc.)")
+	caFile := flag.String("ca-file", "", "PEM file of extra CA certificates to trust")
+	flag.BoolVar(&opts.Client.Insecure, "insecure", opts.Client.Insecure, "don't verify TLS certificates")
+	flag.StringVar(&opts.Client.UserAgent, "user-agent", opts.Client.UserAgent, "User-Agent header to send")
+	flag.Var(headerFlag{&opts.Client.Header}, "header", `extra "Name: value" header to send with every request to the site (repeatable)`)
+	flag.Var(cookieFlag{&opts.Client.Cookies}, "cookie", `extra "name=value" cookie to send with every request to the site (repeatable)`)
+	flag.Var(basicAuthFlag{&opts.Auths}, "basic-auth", `"user:password@host" to log in to host with http basic auth (repeatable)`)
+	flag.Var(bearerAuthFlag{&opts.Auths}, "bearer-token", `"token@host" to send host as a bearer token (repeatable)`)
+	loginURL := flag.String("login-url", "", "URL of a login form to submit before crawling, keeping the session cookies")
+	loginFields := fieldsFlag{make(url.Values)}
+	flag.Var(loginFields, "login-field", `with -login-url, a "name=value" to fill in the login form (repeatable)`)
+	fromDir := flag.String("from-dir", "", "crawl the site from the files in this directory instead of the network, as if served at the first URL")
+	fromWARC := flag.String("from-warc", "", "crawl the site from the responses archived in this WARC file instead of the network")
+	config := flag.String("config", "", "JSON file of flag names and values, i.e. {\"rps\": 2}; flags on the command line win")
+	flag.Parse()
+	if *config != "" {
+		if err := loadConfig(flag.CommandLine, *config); err != nil {
+			log.Fatalf("unable to load config: %v\n", err)
+		}
+	}
+	opts.Workers = int(*nWorkers)
+	if *proxy != "" {
+		u, err := url.Parse(*proxy)
+		if err != nil {
+			log.Fatalf("invalid proxy %q: %v\n", *proxy, err)
+		}
+		opts.Client.Proxy = u
+	}
+	if *loginURL != "" {
+		u, err := url.Parse(*loginURL)
+		if err != nil {
+			log.Fatalf("invalid login URL %q: %v\n", *loginURL, err)
+		}
+		opts.Auths = append(opts.Auths, docrawler.NewFormLogin(u, loginFields.fields))
+	} else if len(loginFields.fields) > 0 {
+		log.Fatalf("-login-field needs a -login-url\n")
+	}
+	if *caFile != "" {
+		pool, err := docrawler.LoadCABundle(*caFile)
+		if err != nil {
+			log.Fatalf("unable to load CA bundle: %v\n", err)
+		}
+		opts.Client.RootCAs = pool
+	}
+	if !docrawler.ValidOutputFormat(out.Format) {
+		log.Fatalf("unknown output format %q\n", out.Format)
+	}
+
+	// the crawl's progress goes to stderr, along with everything else we log
+	opts.Logger = log.Default()
+	out.Logger = log.Default()
+
+	// see if we've got no arguments
+	if flag.NArg() < 1 {
+		fmt.Printf("error: Please specify at least one URL to crawl.\n\n")
+		fmt.Printf("usage: %v [options] <URLs...>\n\n", os.Args[0])
+		fmt.Printf("options:\n")
+		flag.PrintDefaults()
+		fmt.Printf("\n  URLs: URLs to crawl\n\n")
+		fmt.Printf("   or: %v diff [-format=json] <old.json> <new.json>\n\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	if *fromDir != "" && *fromWARC != "" {
+		log.Fatalf("-from-dir and -from-warc can't be used together\n")
+	}
+	if *fromDir != "" {
+		fetcher, err := docrawler.LoadDir(*fromDir, flag.Arg(0))
+		if err != nil {
+			log.Fatalf("unable to load %q: %v\n", *fromDir, err)
+		}
+		opts.Fetcher = fetcher
+	}
+	if *fromWARC != "" {
+		fetcher, err := docrawler.LoadWARC(*fromWARC)
+		if err != nil {
+			log.Fatalf("unable to load WARC file: %v\n", err)
+		}
+		opts.Fetcher = fetcher
+	}
+
+	if opts.Resume && opts.StateDir == "" {
+		log.Fatalf("-resume needs a -state-dir\n")
+	}
+	if opts.StateDir != "" && flag.NArg() > 1 {
+		log.Fatalf("-state-dir only works with a single URL\n")
+	}
+
+	// stop crawling cleanly (and still output what we've got) on ^C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// with -format=ndjson, write out each page as soon as we have it, rather than at the end
+	if out.Format == docrawler.FormatNDJSON {
+		enc := json.NewEncoder(os.Stdout)
+		opts.Hooks.OnPage = func(l *docrawler.Location) {
+			if err := enc.Encode(l); err != nil {
+				log.Fatalf("unable to output location: %v\n", err)
+			}
+		}
+	}
+
+	// crawl each URL on the command line
+	crawler := docrawler.New(opts)
+	for _, u := range flag.Args() {
+		sitemap, err := crawler.Crawl(ctx, []string{u})
+		if err != nil {
+			log.Fatalf("unable to crawl %q: %v\n", u, err)
+		}
+		if out.Format == docrawler.FormatNDJSON {
+			// we've written every page already, so there's only what's missing left
+			for _, l := range sitemap.MissingLocations() {
+				opts.Hooks.OnPage(l)
+			}
+			continue
+		}
+		text, err := sitemap.Format(out)
+		if err != nil {
+			log.Fatalf("unable to output site map for %q: %v\n", u, err)
+		}
+		fmt.Println(text)
+	}
+}
@@ -0,0 +1,238 @@
+package docrawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// SiteDiff is what changed between two crawls of a site
+type SiteDiff struct {
+	Added       []string      // pages only in the new crawl
+	Removed     []string      // pages only in the old crawl
+	Titles      []TitleChange // pages whose title changed
+	Links       []LinkChange  // pages whose links changed
+	NewlyBroken []BrokenLink  // links which are broken now, but weren't
+	Fixed       []BrokenLink  // links which were broken, but aren't now (from the same pages)
+}
+
+// TitleChange is a page whose title changed
+type TitleChange struct {
+	URL string
+	Old string
+	New string
+}
+
+// LinkChange is a page whose links changed
+type LinkChange struct {
+	URL     string
+	Added   []string
+	Removed []string
+}
+
+// BrokenLink is a link which broke (or was fixed), and the pages which link to it
+type BrokenLink struct {
+	URL        string
+	LinkedFrom []string
+}
+
+// LoadLocations reads a site map we output as JSON
+func LoadLocations(path string) ([]*Location, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var all []*Location
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	// pages which had gone by the time of the crawl (or it didn't get to) aren't part of its site map
+	var locations []*Location
+	for _, l := range all {
+		if l.Change != changeGone && l.Change != changeUnchecked {
+			locations = append(locations, l)
+		}
+	}
+	return locations, nil
+}
+
+// locationLinks returns every link from a location, whatever kind of link it is
+func locationLinks(l *Location) []string {
+	var links []string
+	for _, s := range [][]string{l.Links, l.Assets, l.Broken, l.Remote, l.Blocked, l.Frontier, l.Nofollow, l.OutOfScope} {
+		links = append(links, s...)
+	}
+	return uniqStrings(links)
+}
+
+// brokenLinks returns every broken link in a site map, and the pages which link to each
+func brokenLinks(locations []*Location) map[string][]string {
+	broken := make(map[string][]string)
+	for _, l := range locations {
+		for _, b := range l.Broken {
+			broken[b] = append(broken[b], l.URL)
+		}
+	}
+	return broken
+}
+
+// contains returns whether strs includes s
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// difference returns the strings in a which aren't in b, sorted
+func difference(a, b []string) []string {
+	inB := make(map[string]bool)
+	for _, s := range b {
+		inB[s] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !inB[s] {
+			diff = append(diff, s)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// Diff returns what changed between two site maps
+func Diff(before, after []*Location) *SiteDiff {
+	d := &SiteDiff{}
+	oldPages := make(map[string]*Location)
+	for _, l := range before {
+		oldPages[l.URL] = l
+	}
+	newPages := make(map[string]*Location)
+	for _, l := range after {
+		newPages[l.URL] = l
+	}
+
+	// pages which came and went
+	for _, l := range after {
+		if _, ok := oldPages[l.URL]; !ok {
+			d.Added = append(d.Added, l.URL)
+		}
+	}
+	for _, l := range before {
+		if _, ok := newPages[l.URL]; !ok {
+			d.Removed = append(d.Removed, l.URL)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+
+	// and how the pages in both changed
+	for _, n := range after {
+		o, ok := oldPages[n.URL]
+		if !ok {
+			continue
+		}
+		if o.Title != n.Title {
+			d.Titles = append(d.Titles, TitleChange{URL: n.URL, Old: o.Title, New: n.Title})
+		}
+		oldLinks, newLinks := locationLinks(o), locationLinks(n)
+		added, removed := difference(newLinks, oldLinks), difference(oldLinks, newLinks)
+		if len(added) > 0 || len(removed) > 0 {
+			d.Links = append(d.Links, LinkChange{URL: n.URL, Added: added, Removed: removed})
+		}
+	}
+	sort.Slice(d.Titles, func(i, j int) bool { return d.Titles[i].URL < d.Titles[j].URL })
+	sort.Slice(d.Links, func(i, j int) bool { return d.Links[i].URL < d.Links[j].URL })
+
+	// links which broke, or were fixed
+	oldBroken, newBroken := brokenLinks(before), brokenLinks(after)
+	for u, from := range newBroken {
+		if _, ok := oldBroken[u]; !ok {
+			sort.Strings(from)
+			d.NewlyBroken = append(d.NewlyBroken, BrokenLink{URL: u, LinkedFrom: from})
+		}
+	}
+	// a link is only fixed where the same page still links to it, and it works. one which
+	// went along with its page, or was taken off it, is a removed page or link instead
+	for u, from := range oldBroken {
+		var fixed []string
+		for _, p := range from {
+			n, ok := newPages[p]
+			if ok && contains(locationLinks(n), u) && !contains(n.Broken, u) {
+				fixed = append(fixed, p)
+			}
+		}
+		if len(fixed) > 0 {
+			sort.Strings(fixed)
+			d.Fixed = append(d.Fixed, BrokenLink{URL: u, LinkedFrom: fixed})
+		}
+	}
+	sort.Slice(d.NewlyBroken, func(i, j int) bool { return d.NewlyBroken[i].URL < d.NewlyBroken[j].URL })
+	sort.Slice(d.Fixed, func(i, j int) bool { return d.Fixed[i].URL < d.Fixed[j].URL })
+	return d
+}
+
+// empty returns whether nothing changed
+func (d *SiteDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Titles) == 0 && len(d.Links) == 0 &&
+		len(d.NewlyBroken) == 0 && len(d.Fixed) == 0
+}
+
+// Text returns the diff in a form for humans
+func (d *SiteDiff) Text() string {
+	if d.empty() {
+		return "No changes.\n"
+	}
+	var b strings.Builder
+	section := func(title string, n int) bool {
+		if n == 0 {
+			return false
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%v (%v):\n", title, n)
+		return true
+	}
+	if section("Added pages", len(d.Added)) {
+		for _, u := range d.Added {
+			fmt.Fprintf(&b, "  + %v\n", u)
+		}
+	}
+	if section("Removed pages", len(d.Removed)) {
+		for _, u := range d.Removed {
+			fmt.Fprintf(&b, "  - %v\n", u)
+		}
+	}
+	if section("Changed titles", len(d.Titles)) {
+		for _, t := range d.Titles {
+			fmt.Fprintf(&b, "  %v: %q -> %q\n", t.URL, t.Old, t.New)
+		}
+	}
+	if section("Changed links", len(d.Links)) {
+		for _, l := range d.Links {
+			fmt.Fprintf(&b, "  %v\n", l.URL)
+			for _, u := range l.Added {
+				fmt.Fprintf(&b, "    + %v\n", u)
+			}
+			for _, u := range l.Removed {
+				fmt.Fprintf(&b, "    - %v\n", u)
+			}
+		}
+	}
+	if section("Newly broken links", len(d.NewlyBroken)) {
+		for _, l := range d.NewlyBroken {
+			fmt.Fprintf(&b, "  %v (linked from %v)\n", l.URL, strings.Join(l.LinkedFrom, ", "))
+		}
+	}
+	if section("Fixed broken links", len(d.Fixed)) {
+		for _, l := range d.Fixed {
+			fmt.Fprintf(&b, "  %v (was linked from %v)\n", l.URL, strings.Join(l.LinkedFrom, ", "))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package docrawler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testDiffSites are an old and a new site map with one of every kind of change
+var testDiffSites = [2][]*Location{
+	{
+		{URL: "http://a.com/", Title: "Home", Links: []string{"http://a.com/about", "http://a.com/old"}, Broken: []string{"http://a.com/fixed"}},
+		{URL: "http://a.com/about", Title: "About", Links: []string{"http://a.com/"}},
+		{URL: "http://a.com/old", Title: "Old"},
+	},
+	{
+		{URL: "http://a.com/", Title: "Home", Links: []string{"http://a.com/about", "http://a.com/fixed", "http://a.com/new"}},
+		{URL: "http://a.com/about", Title: "About Us", Links: []string{"http://a.com/"}, Broken: []string{"http://a.com/old"}},
+		{URL: "http://a.com/fixed", Title: "Fixed"},
+		{URL: "http://a.com/new", Title: "New"},
+	},
+}
+
+// TestDiffLocations checks every kind of change is found
+func TestDiffLocations(t *testing.T) {
+	d := Diff(testDiffSites[0], testDiffSites[1])
+	want := &SiteDiff{
+		Added:   []string{"http://a.com/fixed", "http://a.com/new"},
+		Removed: []string{"http://a.com/old"},
+		Titles:  []TitleChange{{URL: "http://a.com/about", Old: "About", New: "About Us"}},
+		Links: []LinkChange{
+			{URL: "http://a.com/", Added: []string{"http://a.com/new"}, Removed: []string{"http://a.com/old"}},
+			{URL: "http://a.com/about", Added: []string{"http://a.com/old"}},
+		},
+		NewlyBroken: []BrokenLink{{URL: "http://a.com/old", LinkedFrom: []string{"http://a.com/about"}}},
+		Fixed:       []BrokenLink{{URL: "http://a.com/fixed", LinkedFrom: []string{"http://a.com/"}}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, wanted %+v", d, want)
+	}
+	text := `Added pages (2):
+  + http://a.com/fixed
+  + http://a.com/new
+
+Removed pages (1):
+  - http://a.com/old
+
+Changed titles (1):
+  http://a.com/about: "About" -> "About Us"
+
+Changed links (2):
+  http://a.com/
+    + http://a.com/new
+    - http://a.com/old
+  http://a.com/about
+    + http://a.com/old
+
+Newly broken links (1):
+  http://a.com/old (linked from http://a.com/about)
+
+Fixed broken links (1):
+  http://a.com/fixed (was linked from http://a.com/)
+`
+	if d.Text() != text {
+		t.Errorf("got:\n%v\nwanted:\n%v", d.Text(), text)
+	}
+	if d := Diff(testDiffSites[1], testDiffSites[1]); !d.empty() || d.Text() != "No changes.\n" {
+		t.Errorf("got %+v comparing a site map to itself", d)
+	}
+}
+
+// TestDiffFixed checks that a broken link is only fixed where its page still links to it, rather
+// than whenever it's no longer broken
+func TestDiffFixed(t *testing.T) {
+	before := []*Location{
+		{URL: "http://a.com/", Broken: []string{"http://a.com/fixed", "http://a.com/unlinked", "http://a.com/still"}},
+		{URL: "http://a.com/old", Broken: []string{"http://a.com/fixed", "http://a.com/gone"}},
+	}
+	after := []*Location{
+		{URL: "http://a.com/", Links: []string{"http://a.com/fixed"}, Broken: []string{"http://a.com/still"}},
+		{URL: "http://a.com/fixed"},
+	}
+	d := Diff(before, after)
+	want := []BrokenLink{{URL: "http://a.com/fixed", LinkedFrom: []string{"http://a.com/"}}}
+	if !reflect.DeepEqual(d.Fixed, want) {
+		t.Errorf("got fixed %+v, wanted %+v", d.Fixed, want)
+	}
+	if !reflect.DeepEqual(d.Removed, []string{"http://a.com/old"}) || len(d.Links) != 1 ||
+		!reflect.DeepEqual(d.Links[0].Removed, []string{"http://a.com/unlinked"}) {
+		t.Errorf("got removed pages %v and links %+v", d.Removed, d.Links)
+	}
+}
+
+// TestLoadLocations checks we can read back a site map we output as JSON, leaving out any
+// pages it says have gone
+func TestLoadLocations(t *testing.T) {
+	j, err := locationsToJSON(append(testDiffSites[1], &Location{URL: "http://a.com/zzz", Change: changeGone}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "sitemap.json")
+	if err := ioutil.WriteFile(path, []byte(j), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadLocations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, testDiffSites[1]) {
+		t.Errorf("got %+v", l)
+	}
+	if _, err := LoadLocations(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing site map")
+	}
+}
@@ -1,16 +1,281 @@
-package main
+// Package docrawler crawls a site and builds a site map of it: every page, what each page
+// links to, and which of those links are broken, redirected, remote and so on.
+//
+//	c := docrawler.New(docrawler.DefaultOptions())
+//	sitemap, err := c.Crawl(ctx, []string{"https://example.com/"})
+//
+// pages are fetched over the network unless Options.Fetcher says otherwise (see
+// MemoryFetcher), and their links are found by our own HTML parser unless Options.Extractor
+// gives a LinkExtractor, which returns each page as a Document listing its Links. results can
+// be had as the crawl goes with Options.Hooks, and its progress logged with Options.Logger.
+package docrawler
 
 import (
-	"flag"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"sync"
 	"time"
 )
 
-// doCrawl begins crawling the site at "homeurl"
-func doCrawl(homeurl string, nWorkers int) itemSlice {
-	// set of what we have already crawled, our results
+// Options holds everything configurable about a crawl
+type Options struct {
+	Workers        int              // number of concurrent fetches (at least 1)
+	IgnoreRobots   bool             // crawl everything, even what robots.txt disallows
+	RPS            float64          // requests per second, per host (0 for no limit)
+	Burst          int              // requests allowed back to back before RPS kicks in
+	MinDelay       time.Duration    // minimum delay between requests to the same host
+	Timeout        time.Duration    // how long the whole crawl may take (0 for no limit)
+	MaxDepth       int              // how many links away from the home page we'll go (0 for no limit)
+	MaxPages       int              // how many URLs we'll crawl (0 for no limit)
+	UseSitemaps    bool             // also crawl the pages listed in the site's sitemaps
+	Client         ClientOptions    // how we make http requests
+	Auths          []Authenticator  // how we get past the site's authentication, if it has any
+	CheckRemote    bool             // check remote links work (but don't crawl them)
+	RemoteWorkers  int              // number of concurrent remote link checks, on top of Workers (at least 1)
+	Scope          ScopeOptions     // which URLs are part of the site
+	Normalize      NormalizeOptions // which URLs we treat as the same page
+	MergeCanonical bool             // fold pages into the page their rel="canonical" points at
+	StateDir       string           // where to keep the crawl's progress, so it can be resumed (empty for nowhere)
+	Resume         bool             // carry on from the progress in StateDir, rather than starting again
+	PreviousDir    string           // the StateDir of a previous crawl, to only fetch what's changed since
+	Fetcher        Fetcher          // where we fetch pages from, or nil for the network (configured by Client)
+	Extractor      LinkExtractor    // how we pull links out of pages, or nil for our own HTML parser
+	Hooks          Hooks            // called as the crawl goes, to see results before it's over
+	Logger         *log.Logger      // where to log the crawl's progress, or nil not to
+}
+
+// Hooks are called as a crawl goes, so results can be used (i.e. written out) before it's over.
+// they're called one at a time, and the crawl waits on each, so they should be quick. any of
+// them may be nil.
+type Hooks struct {
+	// OnPage is called with each page's Location, once the page and everything it links to
+	// have been crawled, and then the crawl lets go of the page's links rather than keep
+	// them for its SiteMap. pages still waiting on links when the crawl ends are passed on then.
+	// what's only known at the end (orphans, canonical findings and aliases) is missing from
+	// a Location passed on before then, and a page merged into its canonical may have been.
+	OnPage func(l *Location)
+
+	// OnLink is called for each link on each page, as the page is crawled
+	OnLink func(from, to string)
+
+	// OnError is called for each URL which turns out to be broken, as it's crawled
+	OnError func(s Status)
+}
+
+// DefaultOptions returns the options we use if nothing else is specified
+func DefaultOptions() Options {
+	return Options{Workers: 100, RemoteWorkers: 10, Burst: 1, Client: DefaultClientOptions(), Scope: ScopeOptions{SameWWW: true}}
+}
+
+// custom errors
+var (
+	errStateSeeds = errors.New("a crawl with a state directory can only have one seed")
+)
+
+// Crawler crawls sites, and can crawl any number of them (one after another)
+type Crawler struct {
+	opts Options
+}
+
+// SiteMap is the result of a crawl: a Location for every page we found, sorted by URL. if
+// Hooks.OnPage is set, each page is passed to that instead, so Locations is left empty
+type SiteMap struct {
+	Locations []*Location
+	Gone      []string // pages the previous crawl found which this one didn't, if there was one
+	Unchecked []string // pages the previous crawl found which this one was cut short before checking
+}
+
+// New returns a Crawler which crawls with opts
+func New(opts Options) *Crawler {
+	return &Crawler{opts: opts}
+}
+
+// Crawl crawls the site at each of seeds in turn, each in its own scope, and returns the site
+// map of all of them. each crawl runs until there's nothing left to crawl, or until ctx is done
+// (or Options.Timeout passes), in which case the partial site map crawled so far is returned.
+func (c *Crawler) Crawl(ctx context.Context, seeds []string) (*SiteMap, error) {
+	if c.opts.StateDir != "" && len(seeds) > 1 {
+		return nil, errStateSeeds
+	}
+	sitemap := &SiteMap{}
+	seen := make(map[string]bool)
+	opts := c.opts
+	if onPage := opts.Hooks.OnPage; onPage != nil && len(seeds) > 1 {
+		// as with the site map, a page found from more than one seed is only passed on once
+		passed := make(map[string]bool)
+		opts.Hooks.OnPage = func(l *Location) {
+			if !passed[l.URL] {
+				passed[l.URL] = true
+				onPage(l)
+			}
+		}
+	}
+	for _, seed := range seeds {
+		pages, missing, err := doCrawl(ctx, seed, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", seed, err)
+		}
+		sitemap.Gone = append(sitemap.Gone, missing.gone...)
+		sitemap.Unchecked = append(sitemap.Unchecked, missing.unchecked...)
+		if opts.Hooks.OnPage != nil {
+			continue // every page has been passed on already, there's no need to keep them too
+		}
+		// seeds on the same site find the same pages, which only belong in the site map once
+		for _, l := range sitemapToLocations(pages) {
+			if !seen[l.URL] {
+				seen[l.URL] = true
+				sitemap.Locations = append(sitemap.Locations, l)
+			}
+		}
+	}
+	sort.Sort(byURL(sitemap.Locations))
+	sitemap.Gone = uniqStrings(sitemap.Gone)
+	sort.Strings(sitemap.Gone)
+	sitemap.Unchecked = uniqStrings(sitemap.Unchecked)
+	sort.Strings(sitemap.Unchecked)
+	return sitemap, nil
+}
+
+// Format returns the site map as text in the format given by opts. JSON (and NDJSON) list any
+// missing pages too, see MissingLocations
+func (m *SiteMap) Format(opts OutputOptions) (string, error) {
+	locations := m.Locations
+	if opts.Format == FormatJSON || opts.Format == FormatNDJSON {
+		locations = append(append([]*Location(nil), locations...), m.MissingLocations()...)
+		sort.Sort(byURL(locations))
+	}
+	return formatLocations(locations, opts)
+}
+
+// MissingLocations returns a Location for each page the previous crawl found which this one
+// didn't, with nothing but its URL and a Change of "gone" (or "unchecked", if the crawl was
+// cut short before it got to the page)
+func (m *SiteMap) MissingLocations() []*Location {
+	var locations []*Location
+	for _, u := range m.Gone {
+		locations = append(locations, &Location{URL: u, Change: changeGone})
+	}
+	for _, u := range m.Unchecked {
+		locations = append(locations, &Location{URL: u, Change: changeUnchecked})
+	}
+	sort.Sort(byURL(locations))
+	return locations
+}
+
+// crawler holds a crawl's options along with any state shared between its workers
+type crawler struct {
+	opts      Options
+	client    *http.Client // doesn't follow redirects, so we can record them
+	extractor LinkExtractor
+	throttle  *throttle
+	robots    *robotsCache
+	scope     *scope      // which URLs are part of the site, set once we know the seed
+	norm      *normalizer // which URLs are the same page
+	state     *stateStore // the crawl's progress on disk, or nil if we're not keeping it
+	previous  itemRecords // the results of a previous crawl, or nil if there wasn't one
+}
+
+// newCrawler returns a crawler with the given options, ready to crawl
+func newCrawler(opts Options) *crawler {
+	c := &crawler{opts: opts, norm: newNormalizer(opts.Normalize), extractor: opts.Extractor}
+	if c.extractor == nil {
+		c.extractor = htmlExtractor{}
+	}
+	c.throttle = newThrottle(opts.RPS, opts.Burst, opts.MinDelay)
+	var next http.RoundTripper
+	if opts.Fetcher != nil {
+		next = &fetcherTransport{fetcher: opts.Fetcher}
+	} else {
+		next = newTransport(opts.Client, c.onSite)
+	}
+	if len(opts.Auths) > 0 {
+		next = &authTransport{next: next, auths: opts.Auths}
+	}
+	transport := &throttledTransport{next: next, throttle: c.throttle}
+	// keep any cookies the site sets, like a browser would, so sessions (i.e. from a login) work
+	jar, _ := cookiejar.New(nil)
+	c.client = &http.Client{Transport: transport, CheckRedirect: noRedirects, Jar: jar}
+	// robots.txt redirects are just followed, we've no need to record them
+	c.robots = newRobotsCache(&http.Client{Transport: transport})
+	return c
+}
+
+// inScope returns whether u is part of the site we're crawling
+func (c *crawler) inScope(u *url.URL) bool {
+	return !c.scope.check(u).out
+}
+
+// onSite returns whether u is on one of the hosts we're crawling, whether or not it's in scope
+func (c *crawler) onSite(u *url.URL) bool {
+	return c.scope.check(u).reason != reasonOtherHost
+}
+
+// doCrawl begins crawling the site at "homeurl". the crawl runs until there's nothing left to
+// crawl, or until ctx is done (or opts.Timeout passes), in which case in-flight requests are
+// cancelled and the partial site map crawled so far is returned. along with it come the URLs
+// of any pages the previous crawl found which this one didn't, if there was one.
+func doCrawl(ctx context.Context, homeurl string, opts Options) (itemSlice, missingPages, error) {
+	// create first page's httpItem
+	homeitem, err := newHTTPItem(nil, homeurl)
+	if err != nil {
+		return nil, missingPages{}, err
+	}
+
+	// apply our global timeout, if any
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// we need at least one worker of each kind we use, or nothing would ever get crawled
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.CheckRemote && opts.RemoteWorkers < 1 {
+		opts.RemoteWorkers = 1
+	}
+
+	c := newCrawler(opts)
+	c.scope = newScope(homeitem.url, opts.Scope)
+	homeitem.scope = scopeDecision{reason: reasonSeed}
+
+	// log in to the site first, if we need to
+	for _, a := range opts.Auths {
+		if err := a.login(ctx, c); err != nil {
+			return nil, missingPages{}, fmt.Errorf("unable to log in: %w", err)
+		}
+	}
+
+	// load a previous crawl, so we only fetch what's changed since then. this comes first, as
+	// it may well be in the state dir we're about to start afresh
+	if opts.PreviousDir != "" {
+		previous, err := loadPrevious(opts.PreviousDir, homeitem.url.String())
+		if err != nil {
+			return nil, missingPages{}, fmt.Errorf("unable to load previous crawl: %w", err)
+		}
+		c.previous = previous
+	}
+
+	// and keep our progress on disk as we go, if we've been asked to
+	if opts.StateDir != "" {
+		state, err := openState(opts.StateDir, homeitem.url.String(), opts.Resume)
+		if err != nil {
+			return nil, missingPages{}, fmt.Errorf("unable to open crawl state: %w", err)
+		}
+		defer state.close()
+		state.logger = opts.Logger
+		c.state = state
+	}
+
+	// set of what we have already crawled, our results, by normalized URL
+	norm := c.norm
 	crawled := make(itemMap)
 
 	// a set of crawled URLs which have been cleaned
@@ -22,129 +287,384 @@ func doCrawl(homeurl string, nWorkers int) itemSlice {
 	rxchan := make(chan *httpItem)
 	txchan := make(chan *httpItem)
 
-	// spin up our crawler workers
-	for i := 0; i < nWorkers; i++ {
-		go crawlWorker(txchan, rxchan)
+	// and to send remote links to check to, which get their own workers so slow remote sites
+	// don't hold up our crawl
+	remotechan := make(chan *httpItem)
+
+	// spin up our crawler workers, and close the results channel once they've all exited
+	var workers sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			crawlWorker(ctx, c, txchan, rxchan)
+		}()
+	}
+	if opts.CheckRemote {
+		for i := 0; i < opts.RemoteWorkers; i++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				crawlWorker(ctx, c, remotechan, rxchan)
+			}()
+		}
 	}
+	go func() {
+		workers.Wait()
+		close(rxchan)
+	}()
 
-	// start a ticker which we'll use to output status and check for completion
-	ticker := time.Tick(250 * time.Millisecond)
+	// start a ticker which we'll use to output status
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
 
-	// create first page's httpItem
-	homeitem, err := newHTTPItem(nil, homeurl)
-	if err != nil {
-		return nil
+	// items waiting for a free worker
+	queue := itemSlice{}
+
+	// remote links waiting for a free remote worker
+	remoteQueue := itemSlice{}
+
+	// items we found but won't crawl because they're past our depth or page limits
+	frontier := make(itemMap)
+
+	// set our number of outstanding pages, queued or in flight, and the number we've queued in total
+	crawlingCount := 0
+	queuedCount := 0
+
+	// and which items those are. a worker may be writing to an item in flight, so this is how
+	// we tell whether an item has its results yet, rather than looking at the item itself
+	outstanding := make(map[*httpItem]bool)
+
+	// enqueue queues up an item to crawl, or puts it on the frontier if it's beyond our limits
+	enqueue := func(item *httpItem) {
+		// remote links aren't part of the site, so they aren't subject to our limits. each is
+		// only ever checked once, since it's in crawled from then on
+		if opts.CheckRemote && item.isRemote() {
+			item.linkType = tUnknown
+			crawlingCount++
+			outstanding[item] = true
+			remoteQueue = append(remoteQueue, item)
+			c.state.queued(norm.key(item.url), item)
+			return
+		}
+		// and anything else out of scope won't be crawled at all, so there's nothing to queue
+		if item.scope.out {
+			item.linkType = item.scope.itemType()
+			c.state.finished(norm.key(item.url), item)
+			return
+		}
+		if (opts.MaxDepth > 0 && item.depth > opts.MaxDepth) || (opts.MaxPages > 0 && queuedCount >= opts.MaxPages) {
+			item.linkType = tFrontier
+			frontier[norm.key(item.url)] = item
+			return
+		}
+		item.linkType = tUnknown
+		delete(frontier, norm.key(item.url))
+		crawlingCount++
+		outstanding[item] = true
+		queuedCount++
+		queue = append(queue, item)
+		c.state.queued(norm.key(item.url), item)
 	}
 
-	// set our number of outstanding pages (initially 1 to account for first page)
-	crawlingCount := 1
+	// different versions of URLs we've crawled (i.e. different anchors), and what they're a version of
+	variants := make(map[*httpItem]*httpItem)
+
+	// every URL (stripped) which some page links to, so we can spot orphans
+	linked := make(map[string]bool)
+
+	// every page we've crawled, by where it actually is (stripped), so a page we reached by
+	// more than one URL (i.e. through a redirect) only shows up once in our results
+	finals := make(itemMap)
+
+	// record keeps a result, and reports it if it's broken
+	record := func(r *httpItem) {
+		crawled[norm.key(r.url)] = r
+		c.state.finished(norm.key(r.url), r)
+		if r.linkType == tBroken && opts.Hooks.OnError != nil {
+			opts.Hooks.OnError(itemToStatus(r))
+		}
+	}
+
+	// pages whose results we've got, but which are waiting on results for some of their
+	// children before we pass them to Hooks.OnPage: how many they're waiting on, and which
+	// pages are waiting on each child
+	waitingOn := make(map[*httpItem]int)
+	waiters := make(map[*httpItem]itemSlice)
+	passed := make(map[*httpItem]bool)
+	passOn := func(p *httpItem) {
+		if opts.Hooks.OnPage != nil && !passed[p] && p.linkType == tHTMLPage && !p.duplicate {
+			passed[p] = true
+			// its children which are versions of other pages haven't got their results yet
+			for _, c := range p.children {
+				if existing, ok := variants[c]; ok {
+					c.copyResults(existing)
+				}
+			}
+			opts.Hooks.OnPage(newLocation(p))
+			// that's all its links are needed for, so don't hold on to them
+			p.children = nil
+		}
+	}
 
 	// start the home page crawl
-	crawled[homeitem.url.String()] = homeitem
-	crawledStripped[stripURL(homeitem.url)] = homeitem
-	txchan <- homeitem
+	crawled[norm.key(homeitem.url)] = homeitem
+	crawledStripped[norm.strippedKey(homeitem.url)] = homeitem
+	enqueue(homeitem)
+
+	// if we're resuming, carry on with whatever we'd queued up but not finished last time
+	if c.state != nil {
+		for key, q := range c.state.pending {
+			if _, ok := crawled[key]; ok {
+				continue
+			}
+			item := restoreQueued(q)
+			if item == nil {
+				continue
+			}
+			item.scope = c.scope.check(item.url)
+			crawled[key] = item
+			crawledStripped[norm.strippedKey(item.url)] = item
+			enqueue(item)
+		}
+	}
+
+	// and look for more pages to crawl in the site's sitemaps, which counts as outstanding
+	// work until we've got them
+	seedchan := make(chan []string, 1)
+	if opts.UseSitemaps {
+		crawlingCount++
+		go func() {
+			seedchan <- c.sitemapSeeds(ctx, homeitem.url)
+		}()
+	}
+
+	// wait for results, until there aren't any more to wait for or we're interrupted
+	interrupted := false
+crawl:
+	for crawlingCount > 0 {
+		// only try to hand out work if we've got some
+		var sendchan chan<- *httpItem
+		var next *httpItem
+		if len(queue) > 0 {
+			sendchan, next = txchan, queue[0]
+		}
+		var remoteSendchan chan<- *httpItem
+		var nextRemote *httpItem
+		if len(remoteQueue) > 0 {
+			remoteSendchan, nextRemote = remotechan, remoteQueue[0]
+		}
 
-	// wait for results
-	for {
 		select {
-		case r := <-rxchan: // new results?
-			// add result to our results map
-			crawled[r.url.String()] = r
+		case sendchan <- next: // a worker took the next item in the queue
+			queue = queue[1:]
+
+		case remoteSendchan <- nextRemote: // a remote worker took the next remote link
+			remoteQueue = remoteQueue[1:]
+
+		case r, ok := <-rxchan: // new results?
+			if !ok {
+				// every worker has exited, so there's nothing more coming
+				interrupted = true
+				break crawl
+			}
+
+			// add result to our results map, and keep it on disk
+			record(r)
 
 			// decrease the outstanding page count by 1
 			crawlingCount--
+			delete(outstanding, r)
+
+			// any page which was only waiting on this one can be passed on now
+			for _, p := range waiters[r] {
+				if waitingOn[p]--; waitingOn[p] == 0 {
+					delete(waitingOn, p)
+					passOn(p)
+				}
+			}
+			delete(waiters, r)
+
+			// if this redirected to a page we've already got, it's a duplicate of that page
+			// and we're done with it. otherwise note where it ended up, so we don't crawl that again
+			if r.linkType == tHTMLPage {
+				final := r.finalURL()
+				if existing, ok := finals[norm.strippedKey(final)]; ok && existing != r {
+					r.duplicate = true
+					continue
+				}
+				finals[norm.strippedKey(final)] = r
+				if _, ok := crawled[norm.key(final)]; !ok {
+					crawled[norm.key(final)] = r
+				}
+				if _, ok := crawledStripped[norm.strippedKey(final)]; !ok {
+					crawledStripped[norm.strippedKey(final)] = r
+				}
+			}
 
 			// start crawly any new child pages we haven't yet crawled
 			for i, c := range r.children {
-				// see if we already have a result for this page
-				// if so, point to that result
-				if existing, ok := crawled[c.url.String()]; ok {
-					r.children[i] = existing
-					continue
+				linked[norm.strippedKey(c.url)] = true
+				if opts.Hooks.OnLink != nil {
+					opts.Hooks.OnLink(r.finalURL().String(), c.url.String())
 				}
 
-				// see if we're already crawling this page (but maybe don't have results yet)
-				// if so, point to that item (we will have it as a result later!)
-				if existing, ok := crawled[c.url.String()]; ok {
+				// see if we already have a result for this page, or are already crawling
+				// it (but maybe don't have results yet). if so, point to that item (we will
+				// have it as a result later!)
+				if existing, ok := crawled[norm.key(c.url)]; ok {
 					r.children[i] = existing
+					if _, ok := frontier[norm.key(c.url)]; ok && c.depth < existing.depth && !c.nofollow {
+						// we've now found a shorter path to a page we skipped for being too deep
+						existing.depth = c.depth
+						enqueue(existing)
+					}
 					continue
 				}
-				if existing, ok := crawledStripped[stripURL(c.url)]; ok {
+				if existing, ok := crawledStripped[norm.strippedKey(c.url)]; ok {
 					// we crawled a different version of this same page
 					// i.e. same page, different anchor. we don't need to crawl it again
-					// but we do need to keep it in our results, so copy the existing
-					// struct over for everything except the URLs
-					r.children[i].title = existing.title
-					r.children[i].linkType = existing.linkType
-					r.children[i].children = existing.children
+					// but we do need to keep it in our results, so once the crawl's done
+					// (and it's got results) copy the existing struct over
+					variants[c] = existing
 					continue
 				}
 
-				// haven't crawled this one yet, do so now
-				crawlingCount++
-				crawled[c.url.String()] = c
-				crawledStripped[stripURL(c.url)] = c
-				go func(newItem *httpItem) {
-					txchan <- newItem
-				}(c)
-			}
+				// we haven't crawled this one yet, but the page asked us not to follow it. we
+				// leave it out of crawled so a followable link elsewhere can still crawl it
+				if c.nofollow {
+					c.linkType = tNofollow
+					continue
+				}
 
-		case <-ticker: // our regular ticker. for status output and checking for completion.
-			// output status to console
-			log.Printf("Crawled %v links, have %v left.\n", len(crawled), crawlingCount)
+				// haven't crawled this one yet, queue it up
+				crawled[norm.key(c.url)] = c
+				crawledStripped[norm.strippedKey(c.url)] = c
+				enqueue(c)
+			}
 
-			// see if we're finished
-			if crawlingCount == 0 {
-				// close our channels, signalling any workers to exit
-				close(txchan)
-				close(rxchan)
+			// pass the page on once all its children have results (or never will)
+			if opts.Hooks.OnPage != nil && r.linkType == tHTMLPage {
+				for _, c := range r.children {
+					if v, ok := variants[c]; ok {
+						c = v
+					}
+					if outstanding[c] {
+						waitingOn[r]++
+						waiters[c] = append(waiters[c], r)
+					}
+				}
+				if waitingOn[r] == 0 {
+					passOn(r)
+				}
+			}
 
-				// finished! convert results map to a slice and return it
-				rslice := itemSlice{}
-				for _, v := range crawled {
-					rslice = append(rslice, v)
+		case seeds := <-seedchan: // pages listed in the sitemaps
+			crawlingCount--
+			// these are treated as if the home page linked to them. it may still be being
+			// crawled, so they're linked from its URL rather than wherever it ends up
+			referrer := &httpItem{url: homeitem.url, depth: homeitem.depth}
+			for _, seed := range seeds {
+				item, err := newHTTPItem(referrer, seed)
+				if err != nil {
+					continue
+				}
+				if item.scope = c.scope.check(item.url); item.scope.out {
+					continue
 				}
-				return rslice
+				if _, ok := crawled[norm.key(item.url)]; ok {
+					continue
+				}
+				if _, ok := crawledStripped[norm.strippedKey(item.url)]; ok {
+					continue
+				}
+				item.inSitemap = true
+				crawled[norm.key(item.url)] = item
+				crawledStripped[norm.strippedKey(item.url)] = item
+				enqueue(item)
 			}
+
+		case <-ticker.C: // our regular ticker, for status output
+			logf(opts.Logger, "Crawled %v links, have %v left.\n", len(crawled), crawlingCount)
+
+		case <-ctx.Done(): // cancelled or timed out, stop handing out work
+			logf(opts.Logger, "Stopping crawl with %v links left: %v\n", crawlingCount, ctx.Err())
+			interrupted = true
+			break crawl
+		}
+	}
+
+	// close the work channels, signalling any workers to exit, then collect anything
+	// still in flight (these finish quickly once ctx is done, as their requests are cancelled)
+	close(txchan)
+	close(remotechan)
+	for r := range rxchan {
+		record(r)
+	}
+
+	// anything we never got to is part of the frontier too
+	for _, item := range queue {
+		item.linkType = tFrontier
+	}
+	for _, item := range remoteQueue {
+		item.linkType = tRemote // but we don't know if it works
+	}
+
+	// say what's changed since the previous crawl. if we didn't crawl everything, what we
+	// didn't get to may not have gone anywhere
+	var missing missingPages
+	if c.previous != nil {
+		var counts map[string]int
+		counts, missing = changeReport(crawled, c.previous, !interrupted && len(frontier) == 0)
+		logf(opts.Logger, "Since the previous crawl: %v unchanged, %v changed, %v new, %v gone, %v unchecked\n",
+			counts[changeUnchanged], counts[changeChanged], counts[changeNew], counts[changeGone], counts[changeUnchecked])
+		for _, u := range missing.gone {
+			logf(opts.Logger, "Gone: %v\n", u)
 		}
 	}
+
+	// work out what each page's canonical refers to, before we copy results to variants
+	resolveCanonicals(crawled, crawledStripped, norm, opts.MergeCanonical)
+
+	// copy results over to the different versions of what we crawled
+	for v, existing := range variants {
+		v.copyResults(existing)
+	}
+
+	// pages we only know about from the sitemap, which nothing links to, are orphans
+	for _, item := range crawled {
+		item.orphan = item.inSitemap && !linked[norm.strippedKey(item.url)]
+	}
+
+	// finished! convert results map to a slice and return it. a page we reached through a
+	// redirect is in the map under both URLs, but only belongs in the slice once
+	rslice := itemSlice{}
+	seen := make(map[*httpItem]bool)
+	for _, v := range crawled {
+		if !seen[v] {
+			seen[v] = true
+			rslice = append(rslice, v)
+		}
+	}
+
+	// and pass on every page which was still waiting on its children
+	if opts.Hooks.OnPage != nil {
+		sort.Slice(rslice, func(i, j int) bool { return rslice[i].finalURL().String() < rslice[j].finalURL().String() })
+		for _, p := range rslice {
+			passOn(p)
+		}
+	}
+	return rslice, missing, nil
 }
 
 // crawlWorker is a goroutine'ized wrapper around crawlItem that listens
 // for new jobs and sends them off to crawlItem, returning the results in rxchan
-func crawlWorker(txchan <-chan *httpItem, rxchan chan<- *httpItem) {
-	// read off the incoming item channel forever
+func crawlWorker(ctx context.Context, c *crawler, txchan <-chan *httpItem, rxchan chan<- *httpItem) {
+	// read off the incoming item channel until it's closed
 	for newJob := range txchan {
 		// perform the crawl
-		newJob.crawlItem()
+		newJob.crawlItem(ctx, c)
 		// return the result
 		rxchan <- newJob
 	}
 }
-
-// main is our program's entry point
-func main() {
-	fmt.Printf("\nD.O. Crawler 1.0  Copyright (c) 2015 Stephen Waits <steve@waits.net>  2015-02-17\n\n")
-	// parse our flags
-	nWorkers := *(flag.Uint("num", 100, "number of workers"))
-	// see if we've got no arguments
-	flag.Parse()
-	if flag.NArg() < 1 {
-		fmt.Printf("error: Please specify at least one URL to crawl.\n\n")
-		fmt.Printf("usage: %v [-num=100] <URLs...>\n\n", os.Args[0])
-		fmt.Printf("  -num=100: number of workers\n")
-		fmt.Printf("  URLs:     URLs to crawl\n\n")
-		os.Exit(1)
-	}
-
-	// crawl each URL on the command line
-	for _, u := range flag.Args() {
-		pages := doCrawl(u, int(nWorkers))
-		if pages == nil {
-			log.Fatalf("unable to crawl %q, may be an invalid URL\n", u)
-		}
-		l := sitemapToLocations(pages)
-		j, _ := locationsToJSON(l)
-		fmt.Println(j)
-	}
-}
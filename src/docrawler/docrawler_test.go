@@ -1,11 +1,20 @@
-package main
+package docrawler
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -13,6 +22,9 @@ const (
 	baseURL = "http://localhost:8765/"
 )
 
+// testsiteModTime is the modification time of every file in our test site
+var testsiteModTime = time.Date(2015, 2, 17, 0, 0, 0, 0, time.UTC)
+
 // TestMain is used so that we can setup an http server, run tests against it, and tear it down
 func TestMain(m *testing.M) {
 	// start our simple web server
@@ -20,12 +32,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		panic("unable to open port for http server")
 	}
-	http.Handle("/", http.FileServer(http.Dir("./testsite")))
+	http.Handle("/", http.FileServer(fixedTimeFS{http.Dir("./testsite")}))
 	go func() {
-		err = http.Serve(l, nil)
-		if err != nil {
-			panic("unable to start http server")
-		}
+		// Serve always returns an error once we close the listener, so ignore that
+		http.Serve(l, nil)
 	}()
 
 	// run tests
@@ -38,6 +48,45 @@ func TestMain(m *testing.M) {
 	os.Exit(exitcode)
 }
 
+// fixedTimeFS is an http.FileSystem which says every file was last modified at
+// testsiteModTime, so Last-Modified is predictable however the test site was checked out
+type fixedTimeFS struct {
+	http.FileSystem
+}
+
+// Open implements http.FileSystem
+func (fs fixedTimeFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return fixedTimeFile{f}, nil
+}
+
+// fixedTimeFile is an http.File whose modification time is testsiteModTime
+type fixedTimeFile struct {
+	http.File
+}
+
+// Stat implements http.File
+func (f fixedTimeFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fixedTimeInfo{info}, nil
+}
+
+// fixedTimeInfo is an os.FileInfo whose modification time is testsiteModTime
+type fixedTimeInfo struct {
+	os.FileInfo
+}
+
+// ModTime implements os.FileInfo
+func (fixedTimeInfo) ModTime() time.Time {
+	return testsiteModTime
+}
+
 // TestServerRunning verifies we can get the baseURL from our test harness http server
 func TestServerRunning(t *testing.T) {
 	resp, err := http.Get(baseURL)
@@ -62,10 +111,16 @@ func TestSimpleFetch(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New httpItem struct")
 	}
-	body, err := page.fetchItem()
+	rc, err := page.fetchItem(context.Background(), newCrawler(DefaultOptions()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
 	if err != nil {
 		t.Fatal(err)
 	}
+	body := string(b)
 	desired := "<html><head></head><body></body></html>\n"
 	if body != desired {
 		t.Logf("   Got: '%v'\n", body)
@@ -74,9 +129,19 @@ func TestSimpleFetch(t *testing.T) {
 	}
 }
 
+// crawlPages crawls seed with opts, failing the test if the crawl can't even start
+func crawlPages(t *testing.T, ctx context.Context, seed string, opts Options) itemSlice {
+	t.Helper()
+	pages, _, err := doCrawl(ctx, seed, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
 // TestSimpleMap figures out the site map for the site in baseURL
 func TestSimpleMap(t *testing.T) {
-	pages := doCrawl(baseURL, 10)
+	pages := crawlPages(t, context.Background(), baseURL, Options{Workers: 10})
 
 	// because our crawl is non-deterministic, we have to do a complete
 	// cycle through every page, counting stuff, finding specific pages
@@ -161,7 +226,7 @@ func TestHeaderFetching(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New httpItem struct")
 	}
-	if err := basepage.fetchFiletype(); err != nil || basepage.linkType != tHTMLPage {
+	if err := basepage.fetchFiletype(context.Background(), newCrawler(DefaultOptions())); err != nil || basepage.linkType != tHTMLPage {
 		t.Error("problem fetching filetype")
 	}
 
@@ -169,7 +234,7 @@ func TestHeaderFetching(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New httpItem struct")
 	}
-	if err := page.fetchFiletype(); err != nil || page.linkType != tHTMLPage {
+	if err := page.fetchFiletype(context.Background(), newCrawler(DefaultOptions())); err != nil || page.linkType != tHTMLPage {
 		t.Error("problem fetching filetype")
 	}
 
@@ -177,15 +242,15 @@ func TestHeaderFetching(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New httpItem struct")
 	}
-	if err := page.fetchFiletype(); err != nil || page.linkType != tAsset {
-		t.Logf("got %q, wanted %q", page.linkType, tAsset)
+	if err := page.fetchFiletype(context.Background(), newCrawler(DefaultOptions())); err != nil || page.linkType != tAsset {
+		t.Logf("got %v, wanted %v", page.linkType, tAsset)
 		t.Error("problem fetching filetype")
 	}
 }
 
 // TestJsonOutput gets a sitemap and then converts it to json
 func TestJsonOutput(t *testing.T) {
-	pages := doCrawl(baseURL, 10)
+	pages := crawlPages(t, context.Background(), baseURL, Options{Workers: 10})
 	l := sitemapToLocations(pages)
 	if len(l) != 2 {
 		t.Error("sitemapToLocations has the wrong number of locations")
@@ -233,6 +298,8 @@ func TestJsonOutput(t *testing.T) {
   {
     "URL": "http://localhost:8765/",
     "Title": "Home",
+    "Base": "http://localhost:8765/",
+    "LastModified": "2015-02-17T00:00:00Z",
     "Links": [
       "http://localhost:8765/about.html"
     ],
@@ -243,11 +310,46 @@ func TestJsonOutput(t *testing.T) {
     "Broken": [
       "http://localhost:8765/zzzbroken.html"
     ],
-    "Remote": null
+    "Remote": null,
+    "Blocked": null,
+    "Frontier": null,
+    "Nofollow": null,
+    "OutOfScope": null,
+    "Orphan": false,
+    "Indexable": true,
+    "Robots": null,
+    "Redirects": null,
+    "BrokenStatus": [
+      {
+        "URL": "http://localhost:8765/zzzbroken.html",
+        "Code": 404,
+        "Class": "http",
+        "Message": "couldn't fetch item: 404 Not Found",
+        "Time": ""
+      }
+    ],
+    "Methods": {
+      "http://localhost:8765/about.html": "GET",
+      "http://localhost:8765/assets/image.png": "HEAD",
+      "http://localhost:8765/scripts/blah.js": "HEAD",
+      "http://localhost:8765/zzzbroken.html": "GET"
+    },
+    "Scope": {
+      "http://localhost:8765/about.html": "in: same host",
+      "http://localhost:8765/assets/image.png": "in: same host",
+      "http://localhost:8765/scripts/blah.js": "in: same host",
+      "http://localhost:8765/zzzbroken.html": "in: same host"
+    },
+    "Canonical": "",
+    "CanonicalFindings": null,
+    "Aliases": null,
+    "Change": ""
   },
   {
     "URL": "http://localhost:8765/about.html",
     "Title": "About Test",
+    "Base": "http://localhost:8765/about.html",
+    "LastModified": "2015-02-17T00:00:00Z",
     "Links": [
       "http://localhost:8765/"
     ],
@@ -258,9 +360,39 @@ func TestJsonOutput(t *testing.T) {
     "Broken": null,
     "Remote": [
       "http://doesntexist23492387492837492374982734.com/"
-    ]
+    ],
+    "Blocked": null,
+    "Frontier": null,
+    "Nofollow": null,
+    "OutOfScope": null,
+    "Orphan": false,
+    "Indexable": true,
+    "Robots": null,
+    "Redirects": null,
+    "BrokenStatus": null,
+    "Methods": {
+      "http://localhost:8765/": "GET",
+      "http://localhost:8765/assets/image.png": "HEAD",
+      "http://localhost:8765/scripts/blah.js": "HEAD"
+    },
+    "Scope": {
+      "http://doesntexist23492387492837492374982734.com/": "out: other host",
+      "http://localhost:8765/": "in: seed",
+      "http://localhost:8765/assets/image.png": "in: same host",
+      "http://localhost:8765/scripts/blah.js": "in: same host"
+    },
+    "Canonical": "",
+    "CanonicalFindings": null,
+    "Aliases": null,
+    "Change": ""
   }
 ]`
+	// when a link broke changes every run, so leave it out of the comparison
+	for _, loc := range l {
+		for i := range loc.BrokenStatus {
+			loc.BrokenStatus[i].Time = ""
+		}
+	}
 	j, err := locationsToJSON(l)
 	if err != nil {
 		t.Error("locationsToJSON failed")
@@ -270,3 +402,290 @@ func TestJsonOutput(t *testing.T) {
 	}
 	t.Log(j)
 }
+
+// TestCrawlTimeout verifies that a crawl of a server which never answers stops at the timeout,
+// and still returns what it has
+func TestCrawlTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// hang until the client gives up
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	pages := crawlPages(t, context.Background(), ts.URL+"/", Options{Workers: 2, Timeout: 100 * time.Millisecond})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("crawl took %v, should have timed out after 100ms", elapsed)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %v pages, wanted 1", len(pages))
+	}
+	if pages[0].linkType != tFrontier {
+		t.Error("interrupted page should be part of the frontier")
+	}
+}
+
+// TestCrawlCancelled verifies that an already cancelled crawl returns right away
+func TestCrawlCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pages := crawlPages(t, ctx, baseURL, Options{Workers: 10})
+	if len(pages) == 0 || len(pages) > 6 {
+		t.Errorf("got %v pages from a cancelled crawl", len(pages))
+	}
+}
+
+// TestCrawlMaxDepth verifies that links past the maximum depth are put on the frontier, unless
+// they're out of scope, which they'd be however deep they were
+func TestCrawlMaxDepth(t *testing.T) {
+	pages := crawlPages(t, context.Background(), baseURL, Options{Workers: 10, MaxDepth: 1})
+	if len(pages) != 6 {
+		t.Fatalf("got %v pages, wanted 6", len(pages))
+	}
+	for _, p := range pages {
+		if p.depth > 1 && p.scope.out && p.linkType != p.scope.itemType() {
+			t.Errorf("%q at depth %v should be out of scope", p.url, p.depth)
+		}
+		if p.depth > 1 && !p.scope.out && p.linkType != tFrontier {
+			t.Errorf("%q at depth %v should be on the frontier", p.url, p.depth)
+		}
+		if p.depth <= 1 && p.linkType == tFrontier {
+			t.Errorf("%q at depth %v should have been crawled", p.url, p.depth)
+		}
+	}
+}
+
+// TestCrawlMaxPages verifies that once we've crawled enough pages, the rest go on the frontier
+func TestCrawlMaxPages(t *testing.T) {
+	pages := crawlPages(t, context.Background(), baseURL, Options{Workers: 10, MaxPages: 1})
+	l := sitemapToLocations(pages)
+	if len(l) != 1 {
+		t.Fatalf("got %v locations, wanted 1", len(l))
+	}
+	if len(l[0].Frontier) != 4 || len(l[0].Links) != 0 || len(l[0].Broken) != 0 {
+		t.Logf("got %+v", l[0])
+		t.Error("unvisited links should be on the frontier")
+	}
+}
+
+// TestCrawlMaxPagesScope verifies that links we won't crawl, because they're remote or out
+// of scope, don't count towards the pages we crawl, or end up on the frontier
+func TestCrawlMaxPagesScope(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.AddPage("http://a.com/", "text/html", []byte(`<a href="http://r1.example/">r1</a> <a href="http://r2.example/">r2</a>
+		<a href="/skip/">skip</a> <a href="/a">a</a> <a href="/b">b</a>`))
+	f.AddPage("http://a.com/a", "text/html", nil)
+	f.AddPage("http://a.com/b", "text/html", nil)
+
+	opts := Options{Workers: 2, IgnoreRobots: true, MaxPages: 2, Fetcher: f, Scope: ScopeOptions{Exclude: []*regexp.Regexp{regexp.MustCompile("/skip/")}}}
+	l := sitemapToLocations(crawlPages(t, context.Background(), "http://a.com/", opts))
+	if len(l) != 2 {
+		t.Fatalf("got %v locations, wanted 2", len(l))
+	}
+	home := l[0]
+	if !reflect.DeepEqual(home.Remote, []string{"http://r1.example/", "http://r2.example/"}) ||
+		!reflect.DeepEqual(home.OutOfScope, []string{"http://a.com/skip/"}) ||
+		!reflect.DeepEqual(home.Links, []string{"http://a.com/a"}) || !reflect.DeepEqual(home.Frontier, []string{"http://a.com/b"}) {
+		t.Errorf("got remote %v, out of scope %v, links %v and frontier %v", home.Remote, home.OutOfScope, home.Links, home.Frontier)
+	}
+}
+
+// TestCrawlSitemaps verifies that pages in the site's sitemaps are crawled, and that ones
+// nothing links to are reported as orphans
+func TestCrawlSitemaps(t *testing.T) {
+	pages := crawlPages(t, context.Background(), baseURL, Options{Workers: 10, UseSitemaps: true})
+	if len(pages) != 7 {
+		t.Fatalf("got %v pages, wanted 7", len(pages))
+	}
+	orphans := 0
+	for _, p := range pages {
+		if p.orphan {
+			orphans++
+			if p.url.String() != baseURL+"orphan.html" || p.linkType != tHTMLPage {
+				t.Errorf("%q shouldn't be an orphan", p.url)
+			}
+		}
+	}
+	if orphans != 1 {
+		t.Errorf("got %v orphans, wanted 1", orphans)
+	}
+}
+
+// TestCrawlNofollow verifies that nofollow links aren't crawled, and noindex pages are reported
+func TestCrawlNofollow(t *testing.T) {
+	pages := crawlPages(t, context.Background(), baseURL+"nofollow.html", Options{Workers: 10})
+	l := sitemapToLocations(pages)
+	if len(l) != 1 {
+		t.Fatalf("got %v locations, wanted 1", len(l))
+	}
+	if l[0].Indexable || len(l[0].Robots) != 1 || l[0].Robots[0] != "noindex" {
+		t.Logf("got %+v", l[0])
+		t.Error("noindex page wasn't reported")
+	}
+	if len(l[0].Nofollow) != 1 || l[0].Nofollow[0] != baseURL+"orphan.html" {
+		t.Logf("got %+v", l[0])
+		t.Error("nofollow link wasn't reported")
+	}
+	if len(l[0].Assets) != 1 {
+		t.Error("regular link wasn't followed")
+	}
+}
+
+// TestCrawler verifies the public API: several seeds on one site give one sorted site map, with
+// each page in it once
+func TestCrawler(t *testing.T) {
+	one, err := New(Options{Workers: 10}).Crawl(context.Background(), []string{baseURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := New(Options{Workers: 10}).Crawl(context.Background(), []string{baseURL, baseURL + "nofollow.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(one.Locations) == 0 || len(both.Locations) < len(one.Locations) {
+		t.Fatalf("got %v locations from one seed and %v from both", len(one.Locations), len(both.Locations))
+	}
+	for i := 1; i < len(both.Locations); i++ {
+		if both.Locations[i-1].URL >= both.Locations[i].URL {
+			t.Errorf("%v and %v are out of order, or duplicated", both.Locations[i-1].URL, both.Locations[i].URL)
+		}
+	}
+	if _, err := both.Format(OutputOptions{Format: FormatJSON}); err != nil {
+		t.Error(err)
+	}
+	ndjson, err := both.Format(OutputOptions{Format: FormatNDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSuffix(ndjson, "\n"), "\n"); len(lines) != len(both.Locations) {
+		t.Errorf("got %v lines of ndjson, wanted %v", len(lines), len(both.Locations))
+	}
+
+	// a state directory only has room for one crawl
+	opts := Options{Workers: 10, StateDir: t.TempDir()}
+	if _, err := New(opts).Crawl(context.Background(), []string{baseURL, baseURL + "nofollow.html"}); !errors.Is(err, errStateSeeds) {
+		t.Errorf("got %v, wanted %v", err, errStateSeeds)
+	}
+}
+
+// TestCrawlZeroOptions verifies a crawl with zero-value options still crawls, with a worker of
+// each kind, rather than having none
+func TestCrawlZeroOptions(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.AddPage("http://a.com/", "text/html", []byte(`<a href="/a">a</a> <a href="http://r.example/">r</a>`))
+	f.AddPage("http://a.com/a", "text/html", nil)
+	f.AddPage("http://r.example/", "text/html", nil)
+
+	for _, opts := range []Options{{Fetcher: f}, {Fetcher: f, CheckRemote: true}} {
+		sitemap, err := New(opts).Crawl(context.Background(), []string{"http://a.com/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sitemap.Locations) != 2 || !reflect.DeepEqual(sitemap.Locations[0].Links, []string{"http://a.com/a"}) ||
+			!reflect.DeepEqual(sitemap.Locations[0].Remote, []string{"http://r.example/"}) {
+			t.Errorf("with check remote %v, got %+v", opts.CheckRemote, sitemap.Locations)
+		}
+	}
+}
+
+// fetcherFunc is a Fetcher which is just a function
+type fetcherFunc func(*http.Request) (*http.Response, error)
+
+// Fetch implements Fetcher
+func (f fetcherFunc) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestCrawlHooks verifies each page is passed on once, as soon as it and its links are
+// crawled (and not kept for the site map too), and that links and errors are reported as
+// they're found
+func TestCrawlHooks(t *testing.T) {
+	site := NewMemoryFetcher()
+	site.AddPage("http://a.com/", "text/html", []byte(`<a href="/a">a</a> <a href="/slow">slow</a> <a href="/missing">missing</a>`))
+	site.AddPage("http://a.com/a", "text/html", []byte(`<a href="/a#top">a</a>`))
+	site.AddPage("http://a.com/slow", "text/html", []byte(`<a href="/">home</a>`))
+
+	// /slow isn't served until /a has been passed on, which it can be as soon as it's crawled
+	streamed := make(chan struct{})
+	fetcher := fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/slow" {
+			select {
+			case <-streamed:
+			case <-time.After(5 * time.Second):
+				t.Error("/a wasn't passed on until the crawl was over")
+			}
+		}
+		return site.Fetch(req)
+	})
+
+	var pages []*Location
+	var links []string
+	var errs []Status
+	opts := Options{Workers: 4, IgnoreRobots: true, Fetcher: fetcher, Hooks: Hooks{
+		OnPage: func(l *Location) {
+			pages = append(pages, l)
+			if l.URL == "http://a.com/a" {
+				close(streamed)
+			}
+		},
+		OnLink:  func(from, to string) { links = append(links, from+" "+to) },
+		OnError: func(s Status) { errs = append(errs, s) },
+	}}
+	sitemap, err := New(opts).Crawl(context.Background(), []string{"http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemap.Locations) != 0 {
+		t.Errorf("got %v locations, they should only have been passed on", len(sitemap.Locations))
+	}
+
+	want := sitemapToLocations(crawlPages(t, context.Background(), "http://a.com/", Options{Workers: 4, IgnoreRobots: true, Fetcher: site}))
+	sort.Sort(byURL(pages))
+	if !reflect.DeepEqual(pages, want) {
+		a, _ := locationsToJSON(pages)
+		b, _ := locationsToJSON(want)
+		t.Errorf("passed on %v, wanted %v", a, b)
+	}
+	if len(links) != 5 {
+		t.Errorf("got links %v", links)
+	}
+	if len(errs) != 1 || errs[0].URL != "http://a.com/missing" || errs[0].Code != http.StatusNotFound {
+		t.Errorf("got errors %+v", errs)
+	}
+}
+
+// TestCrawlHooksInFlight verifies a page which links to a page still being crawled waits for
+// it, and that the crawl doesn't look at a page while a worker is crawling it (run with -race)
+func TestCrawlHooksInFlight(t *testing.T) {
+	site := NewMemoryFetcher()
+	site.AddPage("http://a.com/", "text/html", []byte(`<a href="/a">a</a> <a href="/b">b</a>`))
+	site.AddPage("http://a.com/a", "text/html", []byte(`<a href="/b">b</a>`))
+	site.AddPage("http://a.com/b", "text/html", []byte(`<title>B</title>`))
+	fetcher := fetcherFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/b" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return site.Fetch(req)
+	})
+
+	passed := make(map[string]*Location)
+	opts := Options{Workers: 4, IgnoreRobots: true, Fetcher: fetcher, Hooks: Hooks{
+		OnPage: func(l *Location) { passed[l.URL] = l },
+	}}
+	if _, err := New(opts).Crawl(context.Background(), []string{"http://a.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(passed) != 3 {
+		t.Fatalf("passed on %v pages, wanted 3", len(passed))
+	}
+	// both pages linking to /b must have waited for it, or it'd be broken rather than a page
+	want := map[string][]string{
+		"http://a.com/":  {"http://a.com/a", "http://a.com/b"},
+		"http://a.com/a": {"http://a.com/b"},
+	}
+	for u, links := range want {
+		if l := passed[u]; !reflect.DeepEqual(l.Links, links) || len(l.Broken) > 0 {
+			t.Errorf("%v: got links %v and broken %v, wanted %v", u, l.Links, l.Broken, links)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package docrawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// dotNodeKind is an enum so we know how to style each node in the graph
+type dotNodeKind int
+
+// enums for dotNodeKind
+const (
+	dotPage dotNodeKind = iota
+	dotAsset
+	dotBroken
+	dotRemote
+	dotBlocked
+	dotFrontier
+	dotOutOfScope
+)
+
+// dotNodeStyles are the graphviz attributes for each kind of node
+var dotNodeStyles = map[dotNodeKind]string{
+	dotPage:       `shape=box, style=filled, fillcolor="#cfe2f3"`,
+	dotAsset:      `shape=note, style=filled, fillcolor="#fff2cc"`,
+	dotBroken:     `shape=box, style="filled,dashed", color="#cc0000", fillcolor="#f4cccc"`,
+	dotRemote:     `shape=ellipse, style=filled, fillcolor="#d9d9d9"`,
+	dotBlocked:    `shape=box, style=dashed, color="#e69138"`,
+	dotFrontier:   `shape=box, style=dotted`,
+	dotOutOfScope: `shape=box, style=dotted, color="#999999"`,
+}
+
+// dotEdgeStyles are the graphviz attributes for each kind of edge, which is named for its target
+var dotEdgeStyles = map[dotNodeKind]string{
+	dotPage:       `color="#3d85c6"`,
+	dotAsset:      `style=dashed, color="#999999"`,
+	dotBroken:     `color="#cc0000"`,
+	dotRemote:     `style=dotted, color="#666666"`,
+	dotBlocked:    `style=dotted, color="#e69138"`,
+	dotFrontier:   `style=dotted`,
+	dotOutOfScope: `style=dotted, color="#999999"`,
+}
+
+// dotNode is a single node in the graph
+type dotNode struct {
+	id    string
+	label string
+	kind  dotNodeKind
+	path  string // URL path, used for clustering (empty for remote hosts)
+}
+
+// dotEdge is a single edge in the graph
+type dotEdge struct {
+	from, to string
+	kind     dotNodeKind
+}
+
+// dotQuote quotes s as a graphviz ID
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// dotClusterKey returns the first "depth" segments of path, or empty if path isn't that deep
+func dotClusterKey(path string, depth int) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) <= depth {
+		// not enough directories to belong in a cluster (the last segment is the file itself)
+		return ""
+	}
+	return "/" + strings.Join(segments[:depth], "/")
+}
+
+// locationsToDOT takes a *Location slice and converts it into a graphviz DOT digraph. pages,
+// assets, broken links and so on are styled differently, and remote links are collapsed into
+// one node per remote host. if clusterDepth is more than zero, nodes are grouped into clusters
+// by the first clusterDepth segments of their path.
+func locationsToDOT(locations []*Location, clusterDepth int) (string, error) {
+	nodes := make(map[string]*dotNode)
+	edges := make(map[dotEdge]bool)
+
+	// addNode adds a node for rawurl if we don't have one yet, and returns its id. an existing
+	// node is only updated by a page, since we know the most about those
+	addNode := func(rawurl, title string, kind dotNodeKind) string {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			u = &url.URL{Path: rawurl}
+		}
+		id, label, path := rawurl, u.Path, u.Path
+		if kind == dotRemote {
+			id, label, path = u.Scheme+"://"+u.Host, u.Host, ""
+		}
+		if title != "" {
+			label = title
+		}
+		if label == "" {
+			label = rawurl
+		}
+		if n, ok := nodes[id]; ok {
+			if kind == dotPage && (n.kind != dotPage || title != "") {
+				n.kind, n.label = kind, label
+			}
+			return id
+		}
+		nodes[id] = &dotNode{id: id, label: label, kind: kind, path: path}
+		return id
+	}
+
+	// walk every page, adding it and everything it links to
+	for _, l := range locations {
+		from := addNode(l.URL, l.Title, dotPage)
+		children := []struct {
+			urls []string
+			kind dotNodeKind
+		}{
+			{l.Links, dotPage},
+			{l.Assets, dotAsset},
+			{l.Broken, dotBroken},
+			{l.Remote, dotRemote},
+			{l.Blocked, dotBlocked},
+			{l.Frontier, dotFrontier},
+			{l.OutOfScope, dotOutOfScope},
+		}
+		for _, c := range children {
+			for _, u := range c.urls {
+				to := addNode(u, "", c.kind)
+				edges[dotEdge{from, to, c.kind}] = true
+			}
+		}
+	}
+
+	// sort everything so our output is stable
+	var sortedNodes []*dotNode
+	for _, n := range nodes {
+		sortedNodes = append(sortedNodes, n)
+	}
+	sort.Slice(sortedNodes, func(i, j int) bool { return sortedNodes[i].id < sortedNodes[j].id })
+	var sortedEdges []dotEdge
+	for e := range edges {
+		sortedEdges = append(sortedEdges, e)
+	}
+	sort.Slice(sortedEdges, func(i, j int) bool {
+		if sortedEdges[i].from != sortedEdges[j].from {
+			return sortedEdges[i].from < sortedEdges[j].from
+		}
+		return sortedEdges[i].to < sortedEdges[j].to
+	})
+
+	// group nodes into clusters by path prefix (cluster "" is the top level)
+	clusters := make(map[string][]*dotNode)
+	var clusterKeys []string
+	for _, n := range sortedNodes {
+		key := ""
+		if clusterDepth > 0 && n.path != "" {
+			key = dotClusterKey(n.path, clusterDepth)
+		}
+		if _, ok := clusters[key]; !ok {
+			clusterKeys = append(clusterKeys, key)
+		}
+		clusters[key] = append(clusters[key], n)
+	}
+	sort.Strings(clusterKeys)
+
+	// and write it all out
+	var b strings.Builder
+	b.WriteString("digraph sitemap {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	b.WriteString("  edge [arrowsize=0.6];\n")
+	for i, key := range clusterKeys {
+		indent := "  "
+		if key != "" {
+			fmt.Fprintf(&b, "\n  subgraph cluster_%d {\n", i)
+			fmt.Fprintf(&b, "    label=%s;\n", dotQuote(key))
+			b.WriteString("    style=rounded;\n")
+			indent = "    "
+		} else {
+			b.WriteString("\n")
+		}
+		for _, n := range clusters[key] {
+			fmt.Fprintf(&b, "%s%s [label=%s, %s];\n", indent, dotQuote(n.id), dotQuote(n.label), dotNodeStyles[n.kind])
+		}
+		if key != "" {
+			b.WriteString("  }\n")
+		}
+	}
+	b.WriteString("\n")
+	for _, e := range sortedEdges {
+		fmt.Fprintf(&b, "  %s -> %s [%s];\n", dotQuote(e.from), dotQuote(e.to), dotEdgeStyles[e.kind])
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
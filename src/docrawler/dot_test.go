@@ -0,0 +1,84 @@
+package docrawler
+
+import (
+	"strings"
+	"testing"
+)
+
+// testDOTLocations is a small site map to convert to DOT
+var testDOTLocations = []*Location{
+	{
+		URL:    "http://a.com/",
+		Title:  "Home \"Page\"",
+		Links:  []string{"http://a.com/docs/api/index.html"},
+		Assets: []string{"http://a.com/img/logo.png"},
+		Broken: []string{"http://a.com/gone.html"},
+		Remote: []string{"http://b.com/x.html", "http://b.com/y.html"},
+	},
+	{
+		URL:   "http://a.com/docs/api/index.html",
+		Title: "API",
+		Links: []string{"http://a.com/"},
+	},
+}
+
+// TestDOTOutput verifies nodes and edges are present and styled by type
+func TestDOTOutput(t *testing.T) {
+	dot, err := locationsToDOT(testDOTLocations, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []string{
+		"digraph sitemap {",
+		`"http://a.com/" [label="Home \"Page\"", ` + dotNodeStyles[dotPage] + "];",
+		`"http://a.com/img/logo.png" [label="/img/logo.png", ` + dotNodeStyles[dotAsset] + "];",
+		`"http://a.com/gone.html" [label="/gone.html", ` + dotNodeStyles[dotBroken] + "];",
+		`"http://b.com" [label="b.com", ` + dotNodeStyles[dotRemote] + "];",
+		`"http://a.com/" -> "http://a.com/docs/api/index.html" [` + dotEdgeStyles[dotPage] + "];",
+		`"http://a.com/" -> "http://b.com" [` + dotEdgeStyles[dotRemote] + "];",
+		`"http://a.com/docs/api/index.html" -> "http://a.com/" [` + dotEdgeStyles[dotPage] + "];",
+	}
+	for _, w := range wanted {
+		if !strings.Contains(dot, w) {
+			t.Errorf("missing %q", w)
+		}
+	}
+
+	// both remote URLs should have collapsed into one edge to the remote host
+	if strings.Count(dot, `-> "http://b.com"`) != 1 {
+		t.Error("remote URLs weren't collapsed into their host")
+	}
+	if strings.Contains(dot, "subgraph") {
+		t.Error("got clusters when clustering was off")
+	}
+	t.Log(dot)
+}
+
+// TestDOTClusters verifies that nodes are clustered by path prefix
+func TestDOTClusters(t *testing.T) {
+	dot, err := locationsToDOT(testDOTLocations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{`label="/docs";`, `label="/img";`} {
+		if !strings.Contains(dot, w) {
+			t.Errorf("missing cluster %q", w)
+		}
+	}
+	if strings.Contains(dot, `label="/gone.html";`) {
+		t.Error("top level file shouldn't get its own cluster")
+	}
+}
+
+// TestDOTClusterKey verifies path prefixes at different depths
+func TestDOTClusterKey(t *testing.T) {
+	if k := dotClusterKey("/docs/api/index.html", 2); k != "/docs/api" {
+		t.Errorf("got %q", k)
+	}
+	if k := dotClusterKey("/docs/api/index.html", 3); k != "" {
+		t.Errorf("got %q", k)
+	}
+	if k := dotClusterKey("/", 1); k != "" {
+		t.Errorf("got %q", k)
+	}
+}
@@ -1,49 +1,120 @@
-package main
+package docrawler
 
 import (
+	"context"
 	"errors"
-	"io/ioutil"
+	"fmt"
+	"io"
 	"mime"
 	"net/http"
+	"net/url"
 )
 
 // custom errors
 var (
 	errContentTypeNotFound = errors.New("no Content-Type header found")
 	errFetchError          = errors.New("couldn't fetch item")
-	errFileTypeUnknown     = errors.New("couldn't determine file type")
 )
 
-// fetchFiletype performs an http HEAD to get the media type, and sets it
-// directly in httpItem.mediaType
-func (item *httpItem) fetchFiletype() error {
-	resp, err := http.Head(item.url.String())
+// assetElements are elements whose links are almost certainly to assets rather than pages, so
+// we can check them with a HEAD rather than downloading them
+var assetElements = map[string]bool{
+	"img":    true,
+	"script": true,
+	"source": true,
+	"video":  true,
+	"audio":  true,
+	"track":  true,
+	"embed":  true,
+	"input":  true,
+}
+
+// fetch performs a single http request with the crawler's client (adding any extra header),
+// which is cancelled if ctx is done. it doesn't follow redirects, see follow for that.
+func (c *crawler) fetch(ctx context.Context, method string, u *url.URL, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
 	if err != nil {
-		item.linkType = tBroken
-		return err
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return c.client.Do(req)
+}
+
+// request fetches the item with method (and any extra header), following any redirects and
+// recording them in the item. an item which fails to fetch is marked broken, unless it redirected out of scope, in
+// which case it's remote (or just out of scope).
+func (item *httpItem) request(ctx context.Context, c *crawler, method string, header http.Header) (*http.Response, error) {
+	// we only follow redirects out of scope for remote items, which are out of scope already
+	var inScope func(*url.URL) bool
+	if !item.isRemote() {
+		inScope = c.inScope
+	}
+	item.method = method
+	resp, chain, err := c.follow(ctx, method, item.url, header, inScope)
+	item.redirects = chain
+	if errors.Is(err, errRedirectOutOfScope) {
+		item.scope = c.scope.check(item.finalURL())
+		item.linkType = item.scope.itemType()
+	} else if err != nil {
+		item.fail(classifyError(err), 0, err)
 	}
+	return resp, err
+}
+
+// head requests the item with an http HEAD, falling back to a GET if the server doesn't
+// support HEAD
+func (item *httpItem) head(ctx context.Context, c *crawler) (*http.Response, error) {
+	resp, err := item.request(ctx, c, http.MethodHead, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return item.request(ctx, c, http.MethodGet, nil)
+}
 
+// classify fills out the item's type (and anything else we can learn) from the headers of
+// the response we got for it
+func (item *httpItem) classify(resp *http.Response) error {
 	// check response code
 	if resp.StatusCode != http.StatusOK {
-		item.linkType = tBroken
-		return errFetchError
+		err := fmt.Errorf("%w: %v", errFetchError, resp.Status)
+		item.fail(classHTTP, resp.StatusCode, err)
+		return err
 	}
 
 	// pull the content type out of the http header
 	contentType, ok := resp.Header["Content-Type"]
 	if !ok {
 		// no Content-Type header found
-		item.linkType = tBroken
+		item.fail(classContent, resp.StatusCode, errContentTypeNotFound)
 		return errContentTypeNotFound
 	}
 
 	// parse mime type
 	mediatype, _, err := mime.ParseMediaType(contentType[0])
 	if err != nil {
-		item.linkType = tBroken
+		item.fail(classContent, resp.StatusCode, err)
 		return err
 	}
 
+	// note any robots directives in the headers. these replace any from an earlier request
+	// for the item, i.e. the HEAD before a GET
+	item.robots = nil
+	for _, v := range resp.Header.Values("X-Robots-Tag") {
+		item.robots = append(item.robots, parseRobotsTag(v)...)
+	}
+
+	// note when it last changed, if the server told us, and its ETag for next time
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		item.lastModified = t
+	}
+	item.etag = resp.Header.Get("ETag")
+
 	// success, set item type and return
 	if mediatype == "text/html" {
 		item.linkType = tHTMLPage
@@ -53,72 +124,162 @@ func (item *httpItem) fetchFiletype() error {
 	return nil
 }
 
-// fetchPage takes a httpItem, GETs it, and returns the body as a string
-func (item *httpItem) fetchItem() (string, error) {
-	// figure out the file type
-	err := item.fetchFiletype()
+// fetchFiletype performs an http HEAD (or a GET, if the server doesn't support HEAD) to get
+// the media type, and sets it directly in httpItem.linkType
+func (item *httpItem) fetchFiletype(ctx context.Context, c *crawler) error {
+	resp, err := item.head(ctx, c)
 	if err != nil {
-		return "", err
-	}
-
-	// make sure we got a file type!
-	if item.linkType == tUnknown {
-		return "", errFileTypeUnknown
+		return err
 	}
+	defer resp.Body.Close()
+	return item.classify(resp)
+}
 
-	// we only want to fetch html, so return if it's anything else
-	if item.linkType != tHTMLPage {
-		return "", nil // but this isn't an error!
+// fetchItem takes a httpItem and fetches it with a single GET, returning the body if it's an
+// html page (which the caller must close), or nil for anything else. links which are almost
+// certainly assets (i.e. from an <img>) are checked with a HEAD instead, and only fetched if
+// they turn out to be html after all.
+func (item *httpItem) fetchItem(ctx context.Context, c *crawler) (io.ReadCloser, error) {
+	if assetElements[item.element] {
+		if err := item.fetchFiletype(ctx, c); err != nil || item.linkType != tHTMLPage {
+			return nil, err
+		}
 	}
 
-	// GET the url
-	resp, err := http.Get(item.url.String())
+	// GET the url, unless it hasn't changed since our previous crawl
+	prev := c.previousPage(item.url)
+	resp, err := item.request(ctx, c, http.MethodGet, conditionalHeader(prev))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	// check response code
-	if resp.StatusCode != http.StatusOK {
-		return "", errFetchError
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		// it hasn't, so it's everything it was last time, except for how we got here
+		resp.Body.Close()
+		redirects := item.redirects
+		item.restore(prev, c)
+		item.redirects = redirects
+		item.change = changeUnchanged
+		return nil, nil
+	}
+	if err := item.classify(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if c.previous != nil {
+		item.change = pageChange(prev, item.etag)
 	}
 
-	// read the body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	// we only want to read html, so don't download anything else
+	if item.linkType != tHTMLPage {
+		resp.Body.Close()
+		return nil, nil // but this isn't an error!
 	}
+	return resp.Body, nil
+}
 
-	// success! close the body, return it as a string
-	resp.Body.Close()
-	return string(body), nil
+// checkRemote probes a remote item with a HEAD (or a GET, if the server doesn't support HEAD)
+// to see whether it's broken. we never parse or follow remote items, so that's all we do.
+func (item *httpItem) checkRemote(ctx context.Context, c *crawler) {
+	resp, err := item.head(ctx, c)
+	if err == nil {
+		err = item.classify(resp)
+		resp.Body.Close()
+	}
+	if err == nil || ctx.Err() != nil {
+		// it works (or we were interrupted, and don't know), either way it's just remote
+		item.linkType = tRemote
+		item.status = nil
+	}
 }
 
 // crawlItem crawls a single httpItem, fetching the header, hte page, parsing it,
 // and filling out its structure as much as possible
-func (item *httpItem) crawlItem() {
-	// make sure this item is the same domain (i.e. URL "host part") as its referrer
-	if item.refurl != nil && item.url.Host != item.refurl.Host {
-		// skip URLs associated with other Hosts
-		item.linkType = tRemote
+func (item *httpItem) crawlItem(ctx context.Context, c *crawler) {
+	// if we're resuming a crawl which already got this item, there's nothing to fetch
+	if rec, ok := c.state.result(c.norm.key(item.url)); ok {
+		item.restore(rec, c)
 		return
 	}
 
+	// make sure this item is part of the site we're crawling
+	if item.scope.out {
+		// skip URLs associated with other Hosts, other than checking they work if we've been asked to
+		item.linkType = item.scope.itemType()
+		if item.isRemote() && c.opts.CheckRemote {
+			item.checkRemote(ctx, c)
+		}
+		return
+	}
+
+	// make sure the site wants us crawling this, and how often
+	if !c.opts.IgnoreRobots {
+		robots := c.robots.get(ctx, item.url)
+		if ctx.Err() != nil {
+			item.linkType = tFrontier
+			return
+		}
+		if !robots.allowed(robotsUserAgent, item.url) {
+			item.linkType = tBlocked
+			return
+		}
+		c.throttle.setCrawlDelay(item.url.Host, robots.crawlDelay(robotsUserAgent))
+	}
+
 	// fetch page
-	text, err := item.fetchItem()
+	body, err := item.fetchItem(ctx, c)
 	if err != nil {
+		if ctx.Err() != nil {
+			// we didn't fail, we were interrupted, so this is part of the frontier
+			item.linkType = tFrontier
+			item.status = nil
+		}
+		return
+	}
+	if body == nil {
+		// not a page, so nothing to parse
 		return
 	}
+	defer body.Close()
 
-	// parse links
-	title, links := parseLinks(text)
-	item.title = title
+	// extract links, straight off the wire
+	doc, err := c.extractor.Extract(body)
+	if err != nil {
+		if ctx.Err() != nil {
+			// we were interrupted part way through, so we haven't really got it yet
+			item.linkType = tFrontier
+			return
+		}
+		item.fail(classifyError(err), http.StatusOK, err)
+		return
+	}
+	item.title = doc.Title
+	item.robots = append(item.robots, doc.Robots...)
+
+	// if the page declared a <base href>, its links are relative to that instead. a relative
+	// one is relative to where the page actually is, after any redirects
+	if doc.Base != "" {
+		if u, err := resolveURL(item.finalURL().String(), doc.Base); err == nil {
+			item.baseurl = u
+		}
+	}
+
+	// note where the page says it really is
+	if doc.Canonical != "" {
+		if u, err := resolveURL(item.base().String(), doc.Canonical); err == nil {
+			item.canonical = u
+		}
+	}
 
 	// walk links and add them as children to the current item
-	for _, l := range links {
-		newItem, err := newHTTPItem(item, l)
+	for _, l := range doc.Links {
+		newItem, err := newHTTPItem(item, l.URL)
 		if err != nil {
 			continue // TODO bad item
 		}
+		newItem.element = l.Element
+		newItem.scope = c.scope.check(newItem.url)
+		// a page's nofollow is about its links to other pages, not the things it's made of
+		newItem.nofollow = l.nofollow() || (l.navigational() && item.hasDirective(directiveNofollow))
 		item.children = append(item.children, newItem)
 	}
 }
@@ -1,7 +1,12 @@
-package main
+package docrawler
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 )
 
 // TestFailedHeaderFetching tests fetchFiletype() to see if we are getting expected failures
@@ -10,7 +15,7 @@ func TestFailedHeaderFetching(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New Page struct")
 	}
-	if err := page.fetchFiletype(); err == nil {
+	if err := page.fetchFiletype(context.Background(), newCrawler(DefaultOptions())); err == nil {
 		t.Error("tired fetching bogus page but didn't get nil back from fetchFiletype")
 	}
 }
@@ -21,7 +26,142 @@ func TestFailedFetching(t *testing.T) {
 	if err != nil {
 		t.Error("problem creating New Page struct")
 	}
-	if _, err := page.fetchItem(); err == nil {
+	if _, err := page.fetchItem(context.Background(), newCrawler(DefaultOptions())); err == nil {
 		t.Error("tired fetching bogus page but didn't get nil back from fetchPage")
 	}
 }
+
+// TestBaseHref verifies that a page's links are resolved against its <base href>
+func TestBaseHref(t *testing.T) {
+	page, err := newHTTPItem(nil, baseURL+"base_test.html")
+	if err != nil {
+		t.Fatal("problem creating New Page struct")
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.base().String() != baseURL+"assets/" {
+		t.Logf("got %q", page.base().String())
+		t.Error("page base is wrong")
+	}
+	if len(page.children) != 1 || page.children[0].url.String() != baseURL+"assets/image.png" {
+		t.Error("link wasn't resolved against the page's base")
+	}
+}
+
+// TestBaseHrefRedirect verifies that a relative <base href> is resolved against where the page
+// redirected to, not the URL we were given
+func TestBaseHrefRedirect(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old/page" {
+			http.Redirect(w, r, "/new/page", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<base href="sub/"><a href="x.html">x</a>`))
+	}))
+	defer ts.Close()
+
+	page, err := newHTTPItem(nil, ts.URL+"/old/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.base().String() != ts.URL+"/new/sub/" {
+		t.Errorf("got base %q", page.base())
+	}
+	if len(page.children) != 1 || page.children[0].url.String() != ts.URL+"/new/sub/x.html" {
+		t.Error("link wasn't resolved against the page's base")
+	}
+}
+
+// TestInterruptedBody verifies that a page whose body we couldn't read all of is broken, unless
+// we were interrupted, in which case it's part of the frontier (and so not done with)
+func TestInterruptedBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "1000")
+		w.Write([]byte(`<a href="/a">a</a>`))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+		}
+		// otherwise the connection's closed short of the Content-Length
+	}))
+	defer ts.Close()
+
+	page, err := newHTTPItem(nil, ts.URL+"/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.linkType != tBroken || page.status == nil || page.status.code != http.StatusOK {
+		t.Errorf("got type %v, status %+v for a short body", page.linkType, page.status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	page, err = newHTTPItem(nil, ts.URL+"/hang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(ctx, newCrawler(DefaultOptions()))
+	if page.linkType != tFrontier || page.status != nil {
+		t.Errorf("got type %v, status %+v for an interrupted body", page.linkType, page.status)
+	}
+}
+
+// methodCountingServer returns a test server which counts requests by method, and serves a
+// page linking to an image. if allowHead is false it refuses HEAD requests.
+func methodCountingServer(allowHead bool) (*httptest.Server, map[string]int) {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		counts[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+		if r.Method == http.MethodHead && !allowHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/image.png" {
+			w.Header().Set("Content-Type", "image/png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/">home</a><img src="/image.png">`))
+	}))
+	return ts, counts
+}
+
+// TestSingleFetch verifies that a page is fetched with just one GET, and an image with a HEAD
+func TestSingleFetch(t *testing.T) {
+	ts, counts := methodCountingServer(true)
+	defer ts.Close()
+	pages := crawlPages(t, context.Background(), ts.URL+"/", Options{Workers: 2, IgnoreRobots: true})
+	if len(pages) != 2 {
+		t.Fatalf("got %v pages, wanted 2", len(pages))
+	}
+	if counts["GET /"] != 1 || counts["HEAD /"] != 0 || counts["HEAD /image.png"] != 1 || counts["GET /image.png"] != 0 {
+		t.Errorf("got requests %v", counts)
+	}
+	for _, p := range pages {
+		if p.url.Path == "/image.png" && (p.linkType != tAsset || p.method != http.MethodHead) {
+			t.Error("image wasn't checked with a HEAD")
+		}
+	}
+}
+
+// TestHeadFallback verifies that we fall back to GET when a server doesn't support HEAD
+func TestHeadFallback(t *testing.T) {
+	ts, counts := methodCountingServer(false)
+	defer ts.Close()
+	page, err := newHTTPItem(nil, ts.URL+"/image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := page.fetchFiletype(context.Background(), newCrawler(DefaultOptions())); err != nil {
+		t.Fatal(err)
+	}
+	if page.linkType != tAsset || page.method != http.MethodGet || counts["GET /image.png"] != 1 {
+		t.Errorf("got type %v with %v, requests %v", page.linkType, page.method, counts)
+	}
+}
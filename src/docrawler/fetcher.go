@@ -0,0 +1,227 @@
+package docrawler
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fetcher makes a single request for the crawler. it mustn't follow redirects, the crawler
+// does that itself so it can record each hop. unless it's given one, the crawler fetches
+// over the network with an http client configured by Options.Client.
+type Fetcher interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// fetcherTransport is an http.RoundTripper which makes its requests with a Fetcher, so our
+// auth, throttle and cookie jar work the same whatever the pages come from
+type fetcherTransport struct {
+	fetcher Fetcher
+}
+
+// RoundTrip implements http.RoundTripper
+func (ft *fetcherTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return ft.fetcher.Fetch(req)
+}
+
+// MemoryResponse is a response a MemoryFetcher serves
+type MemoryResponse struct {
+	Status int // 200 if not set
+	Header http.Header
+	Body   []byte
+}
+
+// MemoryFetcher is a Fetcher which serves responses from memory, by URL, rather than going
+// to the network. anything it hasn't got is a 404.
+type MemoryFetcher struct {
+	mu        sync.RWMutex
+	responses map[string]*MemoryResponse
+}
+
+// NewMemoryFetcher returns an empty MemoryFetcher
+func NewMemoryFetcher() *MemoryFetcher {
+	return &MemoryFetcher{responses: make(map[string]*MemoryResponse)}
+}
+
+// memoryKey returns the key we store the response for u under. requests never send a fragment,
+// and the URLs we crawl are normalized, so the same goes for the URLs we store
+func memoryKey(u *url.URL) string {
+	ucopy := *u
+	ucopy.Fragment = ""
+	ucopy.RawFragment = ""
+	normalizeURL(&ucopy)
+	return ucopy.String()
+}
+
+// Add serves resp for rawurl, replacing anything already there
+func (f *MemoryFetcher) Add(rawurl string, resp *MemoryResponse) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[memoryKey(u)] = resp
+	return nil
+}
+
+// AddPage serves body for rawurl, with a 200 and the given Content-Type
+func (f *MemoryFetcher) AddPage(rawurl string, contentType string, body []byte) error {
+	return f.Add(rawurl, &MemoryResponse{Header: http.Header{"Content-Type": {contentType}}, Body: body})
+}
+
+// Fetch implements Fetcher. like a real server, it answers a conditional request with a 304
+// if the response's ETag or Last-Modified says it hasn't changed, and a HEAD without a body.
+func (f *MemoryFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	r, ok := f.responses[memoryKey(req.URL)]
+	f.mu.RUnlock()
+	if !ok {
+		r = &MemoryResponse{
+			Status: http.StatusNotFound,
+			Header: http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:   []byte("404 page not found\n"),
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := r.Body
+	if status == http.StatusOK && notModified(req, r.Header) {
+		status = http.StatusNotModified
+		body = nil
+	}
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// notModified returns whether a conditional req is for a response with header which hasn't
+// changed, see conditionalHeader
+func notModified(req *http.Request, header http.Header) bool {
+	if etag := header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") != "" {
+		return req.Header.Get("If-None-Match") == etag
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// LoadDir returns a MemoryFetcher which serves the files in dir as the site at base, like a
+// static file server (i.e. http.FileServer) would: each file at its path under base, with a
+// Content-Type from its extension, and each directory as its index.html, or else a listing
+func LoadDir(dir string, base string) (*MemoryFetcher, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+
+	f := NewMemoryFetcher()
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		u := baseURL.ResolveReference(&url.URL{Path: rel})
+		switch {
+		case info.IsDir():
+			// a directory is its index.html if it has one, which replaces this when we get to it
+			u = u.ResolveReference(&url.URL{Path: path.Base(rel) + "/"})
+			body, err := dirListing(p)
+			if err != nil {
+				return err
+			}
+			f.responses[memoryKey(u)] = fileResponse("text/html; charset=utf-8", info, body)
+		case info.Mode().IsRegular():
+			body, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			contentType := mime.TypeByExtension(path.Ext(rel))
+			if contentType == "" {
+				contentType = http.DetectContentType(body)
+			}
+			resp := fileResponse(contentType, info, body)
+			f.responses[memoryKey(u)] = resp
+			if path.Base(rel) == "index.html" {
+				f.responses[memoryKey(u.ResolveReference(&url.URL{Path: "./"}))] = resp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// fileResponse returns the response for a file (or directory) with info, as a static file
+// server would send it
+func fileResponse(contentType string, info os.FileInfo, body []byte) *MemoryResponse {
+	return &MemoryResponse{
+		Header: http.Header{
+			"Content-Type":  {contentType},
+			"Last-Modified": {info.ModTime().UTC().Format(http.TimeFormat)},
+		},
+		Body: body,
+	}
+}
+
+// dirListing returns an html page linking to everything in dir, like http.FileServer's
+func dirListing(dir string) ([]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		href := url.URL{Path: name}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(href.String()), html.EscapeString(name))
+	}
+	b.WriteString("</pre>\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,118 @@
+package docrawler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMemoryFetcher checks we serve what was added, 404 what wasn't, and answer HEADs and
+// conditional requests like a server would
+func TestMemoryFetcher(t *testing.T) {
+	f := NewMemoryFetcher()
+	modified := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	f.Add("http://a.com/page", &MemoryResponse{
+		Header: http.Header{"Content-Type": {"text/html"}, "Etag": {`"v1"`}},
+		Body:   []byte("page"),
+	})
+	f.Add("http://A.com:80/old#top", &MemoryResponse{
+		Header: http.Header{"Content-Type": {"text/html"}, "Last-Modified": {modified.Format(http.TimeFormat)}},
+		Body:   []byte("old"),
+	})
+
+	tests := []struct {
+		method string
+		rawurl string
+		header http.Header
+		status int
+		body   string
+	}{
+		{http.MethodGet, "http://a.com/page", nil, http.StatusOK, "page"},
+		{http.MethodHead, "http://a.com/page", nil, http.StatusOK, ""},
+		{http.MethodGet, "http://a.com/page", http.Header{"If-None-Match": {`"v1"`}}, http.StatusNotModified, ""},
+		{http.MethodGet, "http://a.com/page", http.Header{"If-None-Match": {`"v0"`}}, http.StatusOK, "page"},
+		{http.MethodGet, "http://a.com/old", nil, http.StatusOK, "old"},
+		{http.MethodGet, "http://a.com/old", http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}}, http.StatusNotModified, ""},
+		{http.MethodGet, "http://a.com/old", http.Header{"If-Modified-Since": {modified.Add(-time.Hour).Format(http.TimeFormat)}}, http.StatusOK, "old"},
+		{http.MethodGet, "http://a.com/missing", nil, http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.rawurl, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.header {
+			req.Header[k] = v
+		}
+		resp, err := f.Fetch(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != test.status || string(body) != test.body {
+			t.Errorf("%v %v %v: got %v %q, wanted %v %q", test.method, test.rawurl, test.header, resp.StatusCode, body, test.status, test.body)
+		}
+	}
+}
+
+// TestLoadDir checks that crawling our test site from disk gets exactly what crawling it over
+// http does
+func TestLoadDir(t *testing.T) {
+	f, err := LoadDir("./testsite", baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// our test server says everything was modified at testsiteModTime, whatever's on disk
+	for _, resp := range f.responses {
+		resp.Header.Set("Last-Modified", testsiteModTime.Format(http.TimeFormat))
+	}
+	opts := Options{Workers: 4, UseSitemaps: true}
+	want, err := locationsToJSON(sitemapToLocations(crawlPages(t, context.Background(), baseURL, opts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Fetcher = f
+	got, err := locationsToJSON(sitemapToLocations(crawlPages(t, context.Background(), baseURL, opts)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+}
+
+// lineExtractor is a LinkExtractor which treats each line of a page as a link
+type lineExtractor struct{}
+
+// Extract implements LinkExtractor
+func (lineExtractor) Extract(r io.Reader) (*Document, error) {
+	doc := &Document{Title: "lines"}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			doc.Links = append(doc.Links, Link{URL: line, Element: "a", Attr: "href"})
+		}
+	}
+	return doc, s.Err()
+}
+
+// TestCrawlExtractor checks the crawler finds links with the LinkExtractor it's given
+func TestCrawlExtractor(t *testing.T) {
+	f := NewMemoryFetcher()
+	f.AddPage("http://a.com/", "text/html", []byte("/b\n/c\n"))
+	f.AddPage("http://a.com/b", "text/html", []byte("/\n"))
+	f.AddPage("http://a.com/c", "image/png", nil)
+
+	l := sitemapToLocations(crawlPages(t, context.Background(), "http://a.com/", Options{Workers: 2, IgnoreRobots: true, Fetcher: f, Extractor: lineExtractor{}}))
+	if len(l) != 2 || l[0].Title != "lines" || l[1].URL != "http://a.com/b" {
+		t.Fatalf("got %+v", l)
+	}
+	if len(l[0].Links) != 1 || len(l[0].Assets) != 1 || l[0].Assets[0] != "http://a.com/c" {
+		t.Errorf("got links %v and assets %v", l[0].Links, l[0].Assets)
+	}
+}
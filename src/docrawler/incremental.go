@@ -0,0 +1,108 @@
+package docrawler
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+)
+
+// changes to a page since our previous crawl
+const (
+	changeUnchanged = "unchanged" // the server said it's not modified, or its ETag is the same
+	changeChanged   = "changed"   // it was a page last time too, but it's changed since
+	changeNew       = "new"       // it wasn't a page last time
+	changeGone      = "gone"      // it was a page last time, but it isn't now
+	changeUnchecked = "unchecked" // it was a page last time, but the crawl was cut short before we got to it
+)
+
+// missingPages are the pages a previous crawl found which this one didn't
+type missingPages struct {
+	gone      []string // which aren't pages any more
+	unchecked []string // which we didn't get to, because the crawl was cut short
+}
+
+// loadPrevious loads the results of a previous crawl starting at seed, from its state dir. a
+// crawl with nothing in it (i.e. our first) is fine, everything's just new
+func loadPrevious(dir string, seed string) (itemRecords, error) {
+	s := &stateStore{done: make(itemRecords), pending: make(map[string]*queueRecord)}
+	if err := s.load(filepath.Join(dir, stateFileName), seed); err != nil {
+		return nil, err
+	}
+	return s.done, nil
+}
+
+// previousPage returns u's results from our previous crawl, if it was a page then
+func (c *crawler) previousPage(u *url.URL) *itemRecord {
+	prev, ok := c.previous[c.norm.key(u)]
+	if !ok || prev.Type != tHTMLPage {
+		return nil
+	}
+	return prev
+}
+
+// conditionalHeader returns the headers which ask a server to only send a page if it's changed
+// since prev, or nil if there wasn't a prev (or it didn't give us anything to ask with)
+func conditionalHeader(prev *itemRecord) http.Header {
+	if prev == nil {
+		return nil
+	}
+	header := make(http.Header)
+	if prev.ETag != "" {
+		header.Set("If-None-Match", prev.ETag)
+	}
+	if !prev.LastModified.IsZero() {
+		header.Set("If-Modified-Since", prev.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
+
+// pageChange returns how a page we fetched in full has changed since prev. it can still be
+// unchanged, if the server ignored our conditional request but gave us the same ETag
+func pageChange(prev *itemRecord, etag string) string {
+	switch {
+	case prev == nil:
+		return changeNew
+	case etag != "" && etag == prev.ETag:
+		return changeUnchanged
+	}
+	return changeChanged
+}
+
+// changeReport counts the pages we crawled by how they've changed since the previous crawl,
+// and returns the URLs of any which are missing. unless the crawl was complete (not cut short
+// by a timeout, or our depth and page limits) a page we didn't get to may well still be there,
+// so it's only unchecked
+func changeReport(crawled itemMap, previous itemRecords, complete bool) (map[string]int, missingPages) {
+	counts := make(map[string]int)
+	seen := make(map[*httpItem]bool)
+	for _, item := range crawled {
+		if seen[item] || item.linkType != tHTMLPage || item.duplicate || item.change == "" {
+			continue
+		}
+		seen[item] = true
+		counts[item.change]++
+	}
+	var missing missingPages
+	for key, prev := range previous {
+		if prev.Type != tHTMLPage {
+			continue
+		}
+		item, ok := crawled[key]
+		switch {
+		case ok && item.linkType == tHTMLPage:
+		case !complete && (!ok || item.linkType == tFrontier || item.linkType == tUnknown):
+			missing.unchecked = append(missing.unchecked, prev.URL)
+		default:
+			missing.gone = append(missing.gone, prev.URL)
+		}
+	}
+	sort.Strings(missing.gone)
+	sort.Strings(missing.unchecked)
+	counts[changeGone] = len(missing.gone)
+	counts[changeUnchecked] = len(missing.unchecked)
+	return counts, missing
+}
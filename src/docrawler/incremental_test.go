@@ -0,0 +1,148 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestIncrementalCrawl checks a re-crawl only refetches what's changed, and says what has
+func TestIncrementalCrawl(t *testing.T) {
+	var second atomic.Bool
+	var notModified int32
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			if second.Load() {
+				w.Write([]byte(`<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a> <a href="/new">new</a>`))
+			} else {
+				w.Write([]byte(`<a href="/a">a</a> <a href="/b">b</a> <a href="/c">c</a> <a href="/old">old</a>`))
+			}
+		case "/a":
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`<title>A</title><a href="/c">c</a>`))
+		case "/b":
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(t) {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`<title>B</title>`))
+		case "/c", "/old", "/new":
+			w.Write([]byte(`<title>` + r.URL.Path + `</title>`))
+		}
+	}))
+	defer ts.Close()
+
+	first := t.TempDir()
+	opts := Options{Workers: 2, IgnoreRobots: true, StateDir: first}
+	for _, l := range sitemapToLocations(crawlPages(t, context.Background(), ts.URL+"/", opts)) {
+		if l.Change != "" {
+			t.Errorf("%v changed %q without a previous crawl", l.URL, l.Change)
+		}
+	}
+
+	// a crawl cut short by our page limit can't say what's gone, only what it didn't check
+	second.Store(true)
+	opts = Options{Workers: 2, IgnoreRobots: true, MaxPages: 1, StateDir: t.TempDir(), PreviousDir: first}
+	short, err := New(opts).Crawl(context.Background(), []string{ts.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(short.Gone) != 0 || len(short.Unchecked) != 4 {
+		t.Errorf("got gone %v and unchecked %v from a crawl cut short", short.Gone, short.Unchecked)
+	}
+
+	// crawling into the same state dir as the previous crawl is the usual way to keep it up to date
+	opts = Options{Workers: 2, IgnoreRobots: true, StateDir: first, PreviousDir: first}
+	sitemap, err := New(opts).Crawl(context.Background(), []string{ts.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(map[string]string)
+	var a *Location
+	for _, l := range sitemap.Locations {
+		changes[l.URL[len(ts.URL):]] = l.Change
+		if l.URL == ts.URL+"/a" {
+			a = l
+		}
+	}
+	want := map[string]string{"/": changeChanged, "/a": changeUnchanged, "/b": changeUnchanged, "/c": changeChanged, "/new": changeNew}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, wanted %v", changes, want)
+	}
+	if notModified != 2 {
+		t.Errorf("got %v not modified responses, wanted 2", notModified)
+	}
+	if a == nil || a.Title != "A" || !reflect.DeepEqual(a.Links, []string{ts.URL + "/c"}) {
+		t.Errorf("got %+v, wanted /a as it was", a)
+	}
+	if !reflect.DeepEqual(sitemap.Gone, []string{ts.URL + "/old"}) {
+		t.Errorf("got gone %v", sitemap.Gone)
+	}
+	j, err := sitemap.Format(OutputOptions{Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(j, `"URL": "`+ts.URL+`/old"`) {
+		t.Errorf("gone page isn't in the JSON: %v", j)
+	}
+}
+
+// TestChangeReport checks pages are counted by how they've changed, and gone pages are found,
+// unless the crawl was cut short, when the pages it didn't get to are only unchecked
+func TestChangeReport(t *testing.T) {
+	page := func(rawurl string, linkType itemType, change string) *httpItem {
+		u, _ := url.Parse(rawurl)
+		return &httpItem{url: u, linkType: linkType, change: change}
+	}
+	crawled := itemMap{
+		"http://a.com/":  page("http://a.com/", tHTMLPage, changeChanged),
+		"http://a.com/b": page("http://a.com/b", tHTMLPage, changeUnchanged),
+		"http://a.com/c": page("http://a.com/c", tBroken, ""),
+		"http://a.com/d": page("http://a.com/d", tHTMLPage, changeNew),
+		"http://a.com/g": page("http://a.com/g", tFrontier, ""),
+	}
+	previous := itemRecords{
+		"http://a.com/":  {URL: "http://a.com/", Type: tHTMLPage},
+		"http://a.com/b": {URL: "http://a.com/b", Type: tHTMLPage},
+		"http://a.com/c": {URL: "http://a.com/c", Type: tHTMLPage},
+		"http://a.com/e": {URL: "http://a.com/e", Type: tHTMLPage},
+		"http://a.com/f": {URL: "http://a.com/f", Type: tAsset},
+		"http://a.com/g": {URL: "http://a.com/g", Type: tHTMLPage},
+	}
+	tests := []struct {
+		complete  bool
+		counts    map[string]int
+		gone      []string
+		unchecked []string
+	}{
+		{true, map[string]int{changeChanged: 1, changeUnchanged: 1, changeNew: 1, changeGone: 3, changeUnchecked: 0},
+			[]string{"http://a.com/c", "http://a.com/e", "http://a.com/g"}, nil},
+		{false, map[string]int{changeChanged: 1, changeUnchanged: 1, changeNew: 1, changeGone: 1, changeUnchecked: 2},
+			[]string{"http://a.com/c"}, []string{"http://a.com/e", "http://a.com/g"}},
+	}
+	for _, test := range tests {
+		counts, missing := changeReport(crawled, previous, test.complete)
+		if !reflect.DeepEqual(counts, test.counts) {
+			t.Errorf("complete %v: got %v, wanted %v", test.complete, counts, test.counts)
+		}
+		if !reflect.DeepEqual(missing.gone, test.gone) || !reflect.DeepEqual(missing.unchecked, test.unchecked) {
+			t.Errorf("complete %v: got gone %v and unchecked %v", test.complete, missing.gone, missing.unchecked)
+		}
+	}
+}
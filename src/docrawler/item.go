@@ -1,7 +1,8 @@
-package main
+package docrawler
 
 import (
 	"net/url"
+	"time"
 )
 
 // itemSlice is a convenience type for a slice of items
@@ -20,15 +21,40 @@ const (
 	tAsset
 	tRemote
 	tBroken
+	tBlocked    // disallowed by robots.txt
+	tFrontier   // found, but not crawled because of a depth, page or time limit
+	tNofollow   // not crawled because the link (or its page) said nofollow
+	tOutOfScope // on our host (or one like it), but excluded by our scope rules
 )
 
 // httpItem is a struct which defines a single page, which URLs (links and assets) it contains, etc.
 type httpItem struct {
-	url      *url.URL
-	refurl   *url.URL
-	title    string
-	linkType itemType
-	children itemSlice
+	url          *url.URL
+	refurl       *url.URL
+	baseurl      *url.URL // from the page's <base href>, if it had one
+	depth        int      // number of links away from the home page
+	title        string
+	lastModified time.Time // from the Last-Modified header, if there was one
+	etag         string    // from the ETag header, if there was one
+	change       string    // how it's changed since our previous crawl, see the change* constants
+	linkType     itemType
+	children     itemSlice
+	inSitemap    bool          // found in the site's sitemap, rather than by following a link
+	orphan       bool          // found in the site's sitemap, and nothing links to it
+	robots       []string      // robots directives from the page's <meta> tags and X-Robots-Tag header
+	nofollow     bool          // the link to this item said not to follow it
+	element      string        // the element of the link to this item, i.e. "a" or "img"
+	method       string        // the http method we used to fetch this item
+	redirects    []redirect    // how we got from url to where this item actually is, if it redirected
+	duplicate    bool          // another item redirected to (or is) the same page, so we left this one out
+	status       *fetchStatus  // why this item is broken, if it is
+	scope        scopeDecision // whether we should crawl this item, and why
+
+	canonical         *url.URL   // from the page's <link rel="canonical">, if it had one
+	canonicalItem     *httpItem  // the item canonical refers to, if it's not this one and we found it
+	canonicalFindings []string   // anything wrong with canonical, see the finding* constants
+	mergedInto        *httpItem  // the canonical item we merged this one into, if we did
+	aliases           []*url.URL // other URLs of this page, which were merged into it
 }
 
 // newHTTPItem takes a referring httpItem + a URL and returns a new &httpItem{}
@@ -36,7 +62,7 @@ func newHTTPItem(referrer *httpItem, rawurl string) (*httpItem, error) {
 	// determine the base URL so we can resulve this into a full URL
 	baseURL := ""
 	if referrer != nil {
-		baseURL = referrer.url.String()
+		baseURL = referrer.base().String()
 	}
 
 	// resolve URL into a full absolute URL (non-relative)
@@ -45,12 +71,66 @@ func newHTTPItem(referrer *httpItem, rawurl string) (*httpItem, error) {
 		return nil, err
 	}
 
-	// figure out referrer url
+	// figure out referrer url, and how far we are from the home page
 	var rurl *url.URL
+	depth := 0
 	if referrer != nil {
-		rurl = referrer.url
+		rurl = referrer.finalURL()
+		depth = referrer.depth + 1
 	}
 
 	// create struct and return
-	return &httpItem{url: u, refurl: rurl}, nil
+	return &httpItem{url: u, refurl: rurl, depth: depth}, nil
+}
+
+// copyResults copies the results of crawling another version of the same page (i.e. with a
+// different anchor) into the item, for everything except the URLs
+func (item *httpItem) copyResults(existing *httpItem) {
+	item.title = existing.title
+	item.lastModified = existing.lastModified
+	item.linkType = existing.linkType
+	item.children = existing.children
+	item.redirects = existing.redirects
+	item.status = existing.status
+	item.method = existing.method
+	item.mergedInto = existing.mergedInto
+}
+
+// finalURL returns where this item actually is, which is the end of its redirect chain if
+// it had one
+func (item *httpItem) finalURL() *url.URL {
+	if len(item.redirects) > 0 {
+		return item.redirects[len(item.redirects)-1].to
+	}
+	return item.url
+}
+
+// base returns the URL this item's links are relative to, which is its own (final) URL
+// unless the page declared a different one with <base href>
+func (item *httpItem) base() *url.URL {
+	if item.baseurl != nil {
+		return item.baseurl
+	}
+	return item.finalURL()
+}
+
+// isRemote returns whether the item is on a host we're not crawling
+func (item *httpItem) isRemote() bool {
+	return item.scope.out && item.scope.reason == reasonOtherHost
+}
+
+// hasDirective returns whether the item's robots directives include d (or "none", which
+// covers all of the ones we care about)
+func (item *httpItem) hasDirective(d string) bool {
+	for _, r := range item.robots {
+		if r == d || r == directiveNone {
+			return true
+		}
+	}
+	return false
+}
+
+// indexable returns whether search engines are allowed to index this item
+func (item *httpItem) indexable() bool {
+	return !item.hasDirective(directiveNoindex)
 }
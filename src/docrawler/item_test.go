@@ -1,4 +1,4 @@
-package main
+package docrawler
 
 import (
 	"testing"
@@ -11,3 +11,23 @@ func TestBadnewHTTPItem(t *testing.T) {
 		t.Error("tried creating a newHTTPItem with an invalid URL but didn't get an error")
 	}
 }
+
+// TestNewHTTPItemBase verifies that children are resolved against a referrer's base, if it has one
+func TestNewHTTPItemBase(t *testing.T) {
+	referrer, err := newHTTPItem(nil, "http://a.com/docs/page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := newHTTPItem(referrer, "other.html")
+	if err != nil || child.url.String() != "http://a.com/docs/other.html" {
+		t.Error("child wasn't resolved against referrer's URL")
+	}
+	referrer.baseurl, _ = resolveURL(referrer.url.String(), "/v2/")
+	child, err = newHTTPItem(referrer, "other.html")
+	if err != nil || child.url.String() != "http://a.com/v2/other.html" {
+		t.Error("child wasn't resolved against referrer's base")
+	}
+	if child.refurl != referrer.url {
+		t.Error("child's referrer should still be the page, not its base")
+	}
+}
@@ -0,0 +1,251 @@
+package docrawler
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// urlRule is a single step of URL normalization, which changes u in place
+type urlRule func(u *url.URL)
+
+// standardRules are the normalizations from RFC 3986 section 6, which never change what a
+// URL refers to, so we apply them to every URL we resolve
+var standardRules = []urlRule{
+	lowerSchemeHost,
+	removeDefaultPort,
+	normalizeEscapes,
+	removeDotSegments,
+	emptyPathSlash,
+}
+
+// NormalizeOptions holds the opt-in normalizations, which treat URLs as the same page even
+// though they might not be on every site
+type NormalizeOptions struct {
+	SortQuery         bool     // order query parameters by name
+	StripParams       []string // globs of query parameters to drop, i.e. "utm_*"
+	FoldTrailingSlash bool     // treat /a/ and /a as the same page
+}
+
+// normalizer turns URLs into the keys we use to decide whether we've seen a page already
+type normalizer struct {
+	rules []urlRule
+}
+
+// newNormalizer returns a normalizer with the standard rules, plus any opted into
+func newNormalizer(opts NormalizeOptions) *normalizer {
+	rules := append([]urlRule{}, standardRules...)
+	if len(opts.StripParams) > 0 {
+		rules = append(rules, stripParams(opts.StripParams))
+	}
+	if opts.SortQuery {
+		rules = append(rules, sortQuery)
+	}
+	if opts.FoldTrailingSlash {
+		rules = append(rules, foldTrailingSlash)
+	}
+	return &normalizer{rules: rules}
+}
+
+// normalize returns a normalized copy of u
+func (n *normalizer) normalize(u *url.URL) *url.URL {
+	ucopy := *u
+	for _, rule := range n.rules {
+		rule(&ucopy)
+	}
+	return &ucopy
+}
+
+// key returns the key for u in our map of what we've crawled
+func (n *normalizer) key(u *url.URL) string {
+	return n.normalize(u).String()
+}
+
+// strippedKey returns the key for u in our map of what we've crawled, ignoring fragments and
+// index pages, see stripURL
+func (n *normalizer) strippedKey(u *url.URL) string {
+	return stripURL(n.normalize(u))
+}
+
+// normalizeURL applies the standard rules to u
+func normalizeURL(u *url.URL) {
+	for _, rule := range standardRules {
+		rule(u)
+	}
+}
+
+// setEscapedPath sets u's path from its escaped form, keeping that form when u is printed
+func setEscapedPath(u *url.URL, escaped string) {
+	p, err := url.PathUnescape(escaped)
+	if err != nil {
+		return
+	}
+	u.Path = p
+	u.RawPath = escaped
+}
+
+// lowerSchemeHost lowercases the scheme and host, which are case insensitive
+func lowerSchemeHost(u *url.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+}
+
+// removeDefaultPort drops the port from the host if it's the scheme's default anyway
+func removeDefaultPort(u *url.URL) {
+	switch {
+	case u.Scheme == "http" && strings.HasSuffix(u.Host, ":80"):
+		u.Host = strings.TrimSuffix(u.Host, ":80")
+	case u.Scheme == "https" && strings.HasSuffix(u.Host, ":443"):
+		u.Host = strings.TrimSuffix(u.Host, ":443")
+	}
+}
+
+// normalizeEscapes uppercases the hex digits of percent-encodings in the path and query, and
+// decodes any which didn't need encoding, so %7e and ~ are the same
+func normalizeEscapes(u *url.URL) {
+	setEscapedPath(u, unescapeUnreserved(u.EscapedPath()))
+	u.RawQuery = unescapeUnreserved(u.RawQuery)
+}
+
+// unescapeUnreserved does the work for normalizeEscapes on a single escaped string
+func unescapeUnreserved(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// isHex returns whether c is a hex digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// unhex returns the value of the hex digit c
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// isUnreserved returns whether c never needs percent-encoding in a URL
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// removeDotSegments resolves any "." and ".." segments in an absolute path, as in RFC 3986
+// section 5.2.4, so /a/./b/../c becomes /a/c
+func removeDotSegments(u *url.URL) {
+	escaped := u.EscapedPath()
+	if !strings.HasPrefix(escaped, "/") || !strings.Contains(escaped, ".") {
+		return
+	}
+	segments := strings.Split(escaped, "/")
+	out := []string{""}
+	for i, s := range segments[1:] {
+		last := i == len(segments)-2
+		switch s {
+		case ".":
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		// a trailing dot segment leaves the path ending in a slash
+		if last {
+			out = append(out, "")
+		}
+	}
+	setEscapedPath(u, strings.Join(out, "/"))
+}
+
+// emptyPathSlash gives a URL with a host but no path the path "/", which is the same thing
+func emptyPathSlash(u *url.URL) {
+	if u.Host != "" && u.Opaque == "" && u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	}
+}
+
+// splitQuery splits a raw query into its parameters, keeping them escaped exactly as they were
+func splitQuery(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, "&")
+}
+
+// paramName returns the unescaped name of a raw query parameter
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// sortQuery orders the query parameters by name. parameters with the same name stay in the
+// same order, since that order might matter
+func sortQuery(u *url.URL) {
+	params := splitQuery(u.RawQuery)
+	sort.SliceStable(params, func(i, j int) bool {
+		return paramName(params[i]) < paramName(params[j])
+	})
+	u.RawQuery = strings.Join(params, "&")
+}
+
+// stripParams returns a rule which drops query parameters whose names match any of globs
+func stripParams(globs []string) urlRule {
+	return func(u *url.URL) {
+		var kept []string
+		for _, param := range splitQuery(u.RawQuery) {
+			strip := false
+			for _, glob := range globs {
+				if ok, _ := path.Match(glob, paramName(param)); ok {
+					strip = true
+					break
+				}
+			}
+			if !strip {
+				kept = append(kept, param)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+		if u.RawQuery == "" {
+			u.ForceQuery = false
+		}
+	}
+}
+
+// foldTrailingSlash drops the trailing slash from any path but the root
+func foldTrailingSlash(u *url.URL) {
+	escaped := u.EscapedPath()
+	if escaped != "/" && strings.HasSuffix(escaped, "/") {
+		setEscapedPath(u, strings.TrimSuffix(escaped, "/"))
+	}
+}
@@ -0,0 +1,91 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+// TestNormalize checks each normalization rule, standard and opt-in
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		opts     NormalizeOptions
+		in, want string
+		stripped string // strippedKey, if it's different from want
+	}{
+		{NormalizeOptions{}, "HTTP://Example.COM/a", "http://example.com/a", ""},
+		{NormalizeOptions{}, "http://example.com:80/a", "http://example.com/a", ""},
+		{NormalizeOptions{}, "https://example.com:443/a", "https://example.com/a", ""},
+		{NormalizeOptions{}, "http://example.com:443/a", "http://example.com:443/a", ""},
+		{NormalizeOptions{}, "http://example.com", "http://example.com/", ""},
+		{NormalizeOptions{}, "http://example.com/a/./b/../c", "http://example.com/a/c", ""},
+		{NormalizeOptions{}, "http://example.com/a/b/..", "http://example.com/a/", ""},
+		{NormalizeOptions{}, "http://example.com/../../a", "http://example.com/a", ""},
+		{NormalizeOptions{}, "http://example.com/a.b/c", "http://example.com/a.b/c", ""},
+		{NormalizeOptions{}, "http://example.com/%7euser/%2fx%2F", "http://example.com/~user/%2Fx%2F", ""},
+		{NormalizeOptions{}, "http://example.com/a?q=%41%3d", "http://example.com/a?q=A%3D", ""},
+		{NormalizeOptions{}, "http://example.com/a/index.html#top", "http://example.com/a/index.html#top", "http://example.com/a/"},
+		{NormalizeOptions{}, "http://example.com/a?b=1&a=2", "http://example.com/a?b=1&a=2", ""},
+		{NormalizeOptions{SortQuery: true}, "http://example.com/a?b=1&a=2&b=0", "http://example.com/a?a=2&b=1&b=0", ""},
+		{NormalizeOptions{StripParams: []string{"utm_*", "fbclid"}}, "http://example.com/a?utm_source=x&id=1&fbclid=y", "http://example.com/a?id=1", ""},
+		{NormalizeOptions{StripParams: []string{"utm_*"}}, "http://example.com/a?utm_source=x", "http://example.com/a", ""},
+		{NormalizeOptions{FoldTrailingSlash: true}, "http://example.com/a/", "http://example.com/a", ""},
+		{NormalizeOptions{FoldTrailingSlash: true}, "http://example.com/", "http://example.com/", ""},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original := u.String()
+		n := newNormalizer(test.opts)
+		if got := n.key(u); got != test.want {
+			t.Errorf("%v with %+v: got %v, wanted %v", test.in, test.opts, got, test.want)
+		}
+		stripped := test.stripped
+		if stripped == "" {
+			stripped = test.want
+		}
+		if got := n.strippedKey(u); got != stripped {
+			t.Errorf("%v with %+v: got stripped %v, wanted %v", test.in, test.opts, got, stripped)
+		}
+		if u.String() != original {
+			t.Errorf("%v: normalizing changed the original to %v", test.in, u)
+		}
+	}
+}
+
+// TestCrawlNormalize checks URLs which normalize the same are only crawled once
+func TestCrawlNormalize(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			atomic.AddInt32(&hits, 1)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/a?utm_source=x&id=1">a</a> <a href="/x/../a?id=1&utm_medium=y">a</a>
+			<a href="/%61?id=1">a</a> <a href="/a/?id=1">a</a>`))
+	}))
+	defer ts.Close()
+
+	opts := Options{Workers: 4, IgnoreRobots: true, Normalize: NormalizeOptions{
+		StripParams:       []string{"utm_*"},
+		FoldTrailingSlash: true,
+	}}
+	l := sitemapToLocations(crawlPages(t, context.Background(), ts.URL+"/", opts))
+	var urls []string
+	for _, loc := range l {
+		urls = append(urls, loc.URL)
+	}
+	sort.Strings(urls)
+	if len(urls) != 2 || urls[0] != ts.URL+"/" {
+		t.Errorf("got %v, wanted the home page and one version of /a", urls)
+	}
+	if hits != 1 {
+		t.Errorf("fetched /a %v times, wanted once", hits)
+	}
+}
@@ -1,18 +1,105 @@
-package main
+package docrawler
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"log"
+	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 )
 
+// output formats
+const (
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson" // one Location per line, see Hooks.OnPage for streaming them
+	FormatDOT     = "dot"
+	FormatSitemap = "sitemap"
+)
+
+// OutputOptions holds everything configurable about how we output a site map
+type OutputOptions struct {
+	Format     string      // one of the Format* constants
+	DOTCluster int         // number of leading path segments to cluster DOT nodes by (0 for none)
+	SitemapDir string      // where to write the extra files of a sitemap too big for one file
+	SitemapURL string      // URL the sitemap files will be served from (defaults to the site's root)
+	Logger     *log.Logger // where to log the extra sitemap files we write, or nil not to
+}
+
+// DefaultOutputOptions returns the output options we use if nothing else is specified
+func DefaultOutputOptions() OutputOptions {
+	return OutputOptions{Format: FormatJSON, SitemapDir: "."}
+}
+
+// ValidOutputFormat returns whether we know how to output format
+func ValidOutputFormat(format string) bool {
+	return format == FormatJSON || format == FormatNDJSON || format == FormatDOT || format == FormatSitemap
+}
+
 // Location is a struct which defines a single URL, which URLs (links and assets) it contains, etc.
 type Location struct {
-	URL    string
-	Title  string
-	Links  []string
-	Assets []string
-	Broken []string
-	Remote []string
+	URL               string
+	Title             string
+	Base              string
+	LastModified      string
+	Links             []string
+	Assets            []string
+	Broken            []string
+	Remote            []string
+	Blocked           []string
+	Frontier          []string
+	Nofollow          []string
+	OutOfScope        []string
+	Orphan            bool
+	Indexable         bool
+	Robots            []string
+	Redirects         []Redirect
+	BrokenStatus      []Status
+	Methods           map[string]string
+	Scope             map[string]string
+	Canonical         string   // where the page says it really is, if it said
+	CanonicalFindings []string // anything wrong with Canonical: "off-site", "broken", "redirect" or "chain"
+	Aliases           []string // other URLs of this page, merged into it because of their canonicals
+	Change            string   // "unchanged", "changed" or "new" since the previous crawl, if there was one
+}
+
+// Status is why a link from a Location is broken: its http status code (0 if there was no
+// response), error class, the error itself and when it happened. the class is one of "dns",
+// "tls", "timeout", "refused", "protocol" (any other network failure), "redirect" (a loop, or
+// too many), "http" (a response other than 200) or "content" (a bad Content-Type)
+type Status struct {
+	URL     string
+	Code    int
+	Class   string
+	Message string
+	Time    string
+}
+
+// Redirect is a link from a Location which redirected, along with each hop it took and
+// anything wrong with the chain: "loop", "long-chain" (too many hops) or "downgrade" (a hop
+// from https to http)
+type Redirect struct {
+	From     string
+	To       string
+	Hops     []Hop
+	Findings []string
+}
+
+// Hop is a single step in a redirect chain
+type Hop struct {
+	URL      string
+	Status   int
+	Location string
+}
+
+// itemToRedirect converts the redirect chain of an item into a Redirect
+func itemToRedirect(item *httpItem) Redirect {
+	r := Redirect{From: item.url.String(), To: item.finalURL().String(), Findings: redirectFindings(item.redirects)}
+	for _, h := range item.redirects {
+		r.Hops = append(r.Hops, Hop{URL: h.url.String(), Status: h.status, Location: h.location})
+	}
+	return r
 }
 
 // implement Location slice sorting (by URL)
@@ -23,52 +110,25 @@ func (l byURL) Len() int           { return len(l) }
 func (l byURL) Less(i, j int) bool { return l[i].URL < l[j].URL }
 func (l byURL) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 
-// sitemapToLocations converts an itemSlice to []*Location, which is appropriate for marshalling
-func sitemapToLocations(pages itemSlice) []*Location {
-	// build a map of our pages
-	pageMap := make(map[string]*httpItem)
-	for _, p := range pages {
-		pageMap[p.url.String()] = p
+// itemToStatus converts why an item is broken into a Status
+func itemToStatus(item *httpItem) Status {
+	s := Status{URL: item.url.String()}
+	if item.status != nil {
+		s.Code = item.status.code
+		s.Class = item.status.class
+		s.Message = item.status.message
+		s.Time = item.status.at.Format(time.RFC3339)
 	}
+	return s
+}
 
+// sitemapToLocations converts an itemSlice to []*Location, which is appropriate for marshalling
+func sitemapToLocations(pages itemSlice) []*Location {
 	// build a slice of locations (one per page)
 	var locations []*Location
 	for _, p := range pages {
-		if p.linkType == tHTMLPage {
-			// create a location for this page
-			l := &Location{URL: p.url.String(), Title: p.title}
-
-			// add its children
-			for _, c := range p.children {
-				// look up this child's media type from the root list of pages
-				//mediaType := pageMap[c.url.String()].mediaType
-				if c.linkType == tRemote {
-					l.Remote = append(l.Remote, c.url.String())
-				} else if c.linkType == tHTMLPage {
-					l.Links = append(l.Links, c.url.String())
-				} else if c.linkType == tBroken {
-					l.Broken = append(l.Broken, c.url.String())
-				} else if c.linkType == tAsset {
-					l.Assets = append(l.Assets, c.url.String())
-				} else {
-					// unknown link here, which means it failed to crawl, let's call it "broken"
-					l.Broken = append(l.Broken, c.url.String())
-				}
-
-			}
-
-			// now uniq & sort the children slices
-			l.Remote = uniqStrings(l.Remote)
-			l.Links = uniqStrings(l.Links)
-			l.Broken = uniqStrings(l.Broken)
-			l.Assets = uniqStrings(l.Assets)
-			sort.Strings(l.Remote)
-			sort.Strings(l.Links)
-			sort.Strings(l.Broken)
-			sort.Strings(l.Assets)
-
-			// and add this location to our slice
-			locations = append(locations, l)
+		if p.linkType == tHTMLPage && !p.duplicate {
+			locations = append(locations, newLocation(p))
 		}
 	}
 
@@ -77,6 +137,101 @@ func sitemapToLocations(pages itemSlice) []*Location {
 	return locations
 }
 
+// newLocation returns the Location for a crawled page, which lists its children by what they
+// turned out to be
+func newLocation(p *httpItem) *Location {
+	// create a location for this page, where it actually is
+	l := &Location{URL: p.finalURL().String(), Title: p.title, Base: p.base().String(), Orphan: p.orphan, Change: p.change}
+	l.Indexable = p.indexable()
+	l.Robots = uniqStrings(p.robots)
+	sort.Strings(l.Robots)
+	if !p.lastModified.IsZero() {
+		l.LastModified = p.lastModified.UTC().Format(time.RFC3339)
+	}
+	if p.canonical != nil {
+		l.Canonical = p.canonical.String()
+		l.CanonicalFindings = p.canonicalFindings
+	}
+	for _, a := range p.aliases {
+		l.Aliases = append(l.Aliases, a.String())
+	}
+	sort.Strings(l.Aliases)
+
+	// add its children
+	redirects := make(map[string]Redirect)
+	l.Scope = make(map[string]string)
+	l.Methods = make(map[string]string)
+	status := make(map[string]Status)
+	for _, c := range p.children {
+		// children are listed where they actually are, except for broken links, which
+		// are listed as linked (since they may never have got anywhere). pages merged into
+		// their canonical are listed as that
+		u := c.finalURL().String()
+		if c.mergedInto != nil {
+			u = c.mergedInto.finalURL().String()
+		}
+		if len(c.redirects) > 0 {
+			redirects[c.url.String()] = itemToRedirect(c)
+		}
+		l.Scope[c.url.String()] = c.scope.String()
+		if c.method != "" {
+			l.Methods[c.url.String()] = c.method
+		}
+
+		if c.linkType == tRemote {
+			l.Remote = append(l.Remote, u)
+		} else if c.linkType == tHTMLPage {
+			l.Links = append(l.Links, u)
+		} else if c.linkType == tBroken {
+			l.Broken = append(l.Broken, c.url.String())
+			if c.status != nil {
+				status[c.url.String()] = itemToStatus(c)
+			}
+		} else if c.linkType == tAsset {
+			l.Assets = append(l.Assets, u)
+		} else if c.linkType == tBlocked {
+			l.Blocked = append(l.Blocked, u)
+		} else if c.linkType == tFrontier {
+			l.Frontier = append(l.Frontier, u)
+		} else if c.linkType == tNofollow {
+			l.Nofollow = append(l.Nofollow, u)
+		} else if c.linkType == tOutOfScope {
+			l.OutOfScope = append(l.OutOfScope, u)
+		} else {
+			// unknown link here, which means it failed to crawl, let's call it "broken"
+			l.Broken = append(l.Broken, c.url.String())
+		}
+
+	}
+	for _, r := range redirects {
+		l.Redirects = append(l.Redirects, r)
+	}
+	sort.Slice(l.Redirects, func(i, j int) bool { return l.Redirects[i].From < l.Redirects[j].From })
+	for _, s := range status {
+		l.BrokenStatus = append(l.BrokenStatus, s)
+	}
+	sort.Slice(l.BrokenStatus, func(i, j int) bool { return l.BrokenStatus[i].URL < l.BrokenStatus[j].URL })
+
+	// now uniq & sort the children slices
+	l.Remote = uniqStrings(l.Remote)
+	l.Links = uniqStrings(l.Links)
+	l.Broken = uniqStrings(l.Broken)
+	l.Assets = uniqStrings(l.Assets)
+	l.Blocked = uniqStrings(l.Blocked)
+	l.Frontier = uniqStrings(l.Frontier)
+	l.Nofollow = uniqStrings(l.Nofollow)
+	l.OutOfScope = uniqStrings(l.OutOfScope)
+	sort.Strings(l.Remote)
+	sort.Strings(l.Links)
+	sort.Strings(l.Broken)
+	sort.Strings(l.Assets)
+	sort.Strings(l.Blocked)
+	sort.Strings(l.Frontier)
+	sort.Strings(l.Nofollow)
+	sort.Strings(l.OutOfScope)
+	return l
+}
+
 // locationsToJSON takes a *Location slice and marshals it into a JSON string
 func locationsToJSON(locations []*Location) (string, error) {
 	b, err := json.MarshalIndent(locations, "", "  ")
@@ -85,3 +240,52 @@ func locationsToJSON(locations []*Location) (string, error) {
 	}
 	return string(b), nil
 }
+
+// locationsToNDJSON takes a *Location slice and marshals it into newline delimited JSON, one
+// Location per line
+func locationsToNDJSON(locations []*Location) (string, error) {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	for _, l := range locations {
+		if err := enc.Encode(l); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// locationsToSitemapFiles converts a *Location slice into an XML sitemap, and returns the top
+// level sitemap.xml. if the sitemap had to be split, the rest of its files are written into
+// opts.SitemapDir.
+func locationsToSitemapFiles(locations []*Location, opts OutputOptions) (string, error) {
+	rootURL := opts.SitemapURL
+	if rootURL == "" {
+		rootURL = sitemapRootURL(locations)
+	}
+	files, err := locationsToSitemaps(locations, rootURL, sitemapMaxURLs, sitemapMaxBytes)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files[1:] {
+		path := filepath.Join(opts.SitemapDir, f.name)
+		if err := ioutil.WriteFile(path, []byte(f.data), 0644); err != nil {
+			return "", err
+		}
+		logf(opts.Logger, "Wrote sitemap %v\n", path)
+	}
+	return files[0].data, nil
+}
+
+// formatLocations converts a *Location slice into text in the format given by opts
+func formatLocations(locations []*Location, opts OutputOptions) (string, error) {
+	switch opts.Format {
+	case FormatNDJSON:
+		return locationsToNDJSON(locations)
+	case FormatDOT:
+		return locationsToDOT(locations, opts.DOTCluster)
+	case FormatSitemap:
+		return locationsToSitemapFiles(locations, opts)
+	default:
+		return locationsToJSON(locations)
+	}
+}
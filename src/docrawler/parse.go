@@ -1,29 +1,161 @@
-package main
+package docrawler
 
 import (
-	"regexp"
+	"html"
+	"io"
 	"strings"
 )
 
-// a regexp which captures src/href/xhref="..." from text
-var reURL = regexp.MustCompile(`(?i)(src|href|xhref)\s*=\s*"([^"]+)"`) // TODO make RFC compliant
-var reTitle = regexp.MustCompile(`(?i)<\s*title\s*>([^<]*)<\s*\/\s*title`)
-
-// parseLinks takes a string and attempts to parse any html title and all links out of it,
-// and returns a slice of the captures found
-func parseLinks(s string) (string, []string) {
-	// find the title, or default to empty
-	title := ""
-	titleMatches := reTitle.FindStringSubmatch(s)
-	if titleMatches != nil {
-		// we found a title, replace our default title with the result
-		title = strings.TrimSpace(titleMatches[1])
+// linkAttributes are the attribute names which hold a URL we should follow
+var linkAttributes = map[string]bool{
+	"src":    true,
+	"href":   true,
+	"xhref":  true,
+	"poster": true,
+}
+
+// Link is a single URL found in a document, along with where we found it. Links are only ever
+// seen by a LinkExtractor, which returns them in a Document; once the page is crawled, its
+// Location lists each link by what it turned out to be
+type Link struct {
+	URL     string
+	Element string // the tag the URL was found in, i.e. "a" or "img"
+	Attr    string // the attribute the URL was found in, i.e. "href" or "src"
+	Rel     string // the element's rel attribute, lower case (i.e. "nofollow")
+	Line    int
+	Col     int
+}
+
+// Document is everything a LinkExtractor pulls out of a single page
+type Document struct {
+	Title     string   // the page's title, or empty
+	Base      string   // the href of the page's <base> element, or empty
+	Canonical string   // the href of the page's <link rel="canonical">, or empty
+	Robots    []string // directives from <meta name="robots"> (or our own user agent)
+	Links     []Link
+}
+
+// LinkExtractor pulls the links (and the rest of a Document) out of a page. the crawler only
+// hands it HTML pages, with the body straight off the wire
+type LinkExtractor interface {
+	Extract(r io.Reader) (*Document, error)
+}
+
+// htmlExtractor is the LinkExtractor we use unless we're given another, see parseLinks
+type htmlExtractor struct{}
+
+// Extract implements LinkExtractor
+func (htmlExtractor) Extract(r io.Reader) (*Document, error) {
+	return parseLinks(r)
+}
+
+// parseLinks tokenizes the HTML document in r and returns its title, base and all of the
+// links in it, in document order. links inside comments, scripts and other raw text are
+// ignored.
+func parseLinks(r io.Reader) (*Document, error) {
+	doc := &Document{Links: []Link{}}
+	foundTitle := false
+	foundBase := false
+	inTitle := false
+
+	z := newTokenizer(r)
+	for {
+		t, err := z.next()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, err
+		}
+
+		switch t.typ {
+		case tokStartTag, tokSelfClosingTag:
+			// the first <title> is the one that counts
+			if t.data == "title" && !foundTitle && t.typ == tokStartTag {
+				inTitle = true
+			}
+
+			// so is the first <base> with an href (per the html spec), and it's not a link
+			if t.data == "base" {
+				if href, ok := t.attr("href"); ok && !foundBase {
+					doc.Base = strings.TrimSpace(href)
+					foundBase = true
+				}
+				continue
+			}
+
+			// <meta name="robots" content="noindex, nofollow"> applies to the whole page
+			if t.data == "meta" {
+				name, _ := t.attr("name")
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == "robots" || name == robotsUserAgent {
+					content, _ := t.attr("content")
+					doc.Robots = append(doc.Robots, parseRobotsTag(content)...)
+				}
+				continue
+			}
+
+			// the first <link rel="canonical"> says where the page really is. it's a link too,
+			// so we still check it below
+			rel, _ := t.attr("rel")
+			if href, ok := t.attr("href"); ok && t.data == "link" && doc.Canonical == "" && hasRel(rel, relCanonical) {
+				doc.Canonical = strings.TrimSpace(href)
+			}
+
+			// pick out any attributes holding URLs
+			for _, a := range t.attrs {
+				if linkAttributes[a.key] && strings.TrimSpace(a.val) != "" {
+					doc.Links = append(doc.Links, Link{
+						URL:     strings.TrimSpace(a.val),
+						Element: t.data,
+						Attr:    a.key,
+						Rel:     strings.ToLower(rel),
+						Line:    a.line,
+						Col:     a.col,
+					})
+				}
+			}
+
+		case tokText:
+			if inTitle {
+				// title is "escapable raw text", so entities are allowed
+				doc.Title = strings.TrimSpace(html.UnescapeString(t.data))
+				foundTitle = true
+			}
+
+		case tokEndTag:
+			if t.data == "title" {
+				inTitle = false
+				foundTitle = true
+			}
+		}
 	}
+}
+
+// hasRel returns whether the space separated rel attribute includes value, ignoring case
+func hasRel(rel, value string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// nofollow returns whether the link is marked rel="nofollow"
+func (l *Link) nofollow() bool {
+	return hasRel(l.Rel, directiveNofollow)
+}
 
-	// find all of the URL matches (submatch = include capture groups)
-	results := []string{}
-	for _, match := range reURL.FindAllStringSubmatch(s, -1) {
-		results = append(results, match[2])
+// navigational returns whether the link is one a reader would follow (an <a>, <area>, or a
+// <link> to another page) rather than something the page itself needs, like an image,
+// script or stylesheet
+func (l *Link) navigational() bool {
+	switch l.Element {
+	case "a", "area":
+		return true
+	case "link":
+		return !hasRel(l.Rel, "stylesheet") && !hasRel(l.Rel, "icon")
 	}
-	return title, results
+	return false
 }
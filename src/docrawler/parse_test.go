@@ -1,6 +1,7 @@
-package main
+package docrawler
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -16,20 +17,161 @@ func TestSimpleParse(t *testing.T) {
 		<script href="scripts/blah.js"/>
 	</body>
 </html>`
-	title, matches := parseLinks(doc)
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	title, matches := parsed.Title, parsed.Links
 	if title != "Test Page" {
 		t.Error("got wrong title")
 	}
 	if len(matches) != 3 {
-		t.Error("invalid number of matches in parse")
+		t.Fatal("invalid number of matches in parse")
 	}
-	if matches[0] != "/assets/image.png" {
+	if matches[0].URL != "/assets/image.png" {
 		t.Error("match text is invalid")
 	}
-	if matches[1] != "/about.html" {
+	if matches[1].URL != "/about.html" {
 		t.Error("match text is invalid")
 	}
-	if matches[2] != "scripts/blah.js" {
+	if matches[2].URL != "scripts/blah.js" {
 		t.Error("match text is invalid")
 	}
 }
+
+// TestParseAttributeQuoting verifies that single quoted and unquoted attributes are found
+func TestParseAttributeQuoting(t *testing.T) {
+	doc := `<a href='/single.html'>x</a><a href=/unquoted.html>y</a><IMG SRC = "/spaced.png">`
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := parsed.Links
+	wanted := []string{"/single.html", "/unquoted.html", "/spaced.png"}
+	if len(matches) != len(wanted) {
+		t.Fatalf("got %v matches, wanted %v", len(matches), len(wanted))
+	}
+	for i, w := range wanted {
+		if matches[i].URL != w {
+			t.Errorf("got %q, wanted %q", matches[i].URL, w)
+		}
+	}
+}
+
+// TestParseIgnoresNonMarkup verifies that URLs in comments, scripts and text aren't reported as links
+func TestParseIgnoresNonMarkup(t *testing.T) {
+	doc := `<html>
+<!-- <a href="/commented.html">old</a> -->
+<script>document.write('<a href="/scripted.html">x</a>');</script>
+<pre>use href="/preformatted.html" like this</pre>
+<a href="/real.html">real</a>
+</html>`
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := parsed.Links
+	if len(matches) != 1 || matches[0].URL != "/real.html" {
+		t.Logf("got %v", matches)
+		t.Fatal("found links that aren't really links")
+	}
+}
+
+// TestParseLinkPosition verifies we report the element, attribute, line and column of each link
+func TestParseLinkPosition(t *testing.T) {
+	doc := "<html>\n  <a class=x href=\"/about.html\">about</a>\n</html>"
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := parsed.Links
+	if len(matches) != 1 {
+		t.Fatal("invalid number of matches in parse")
+	}
+	m := matches[0]
+	if m.Element != "a" || m.Attr != "href" || m.Line != 2 || m.Col != 14 {
+		t.Logf("got %+v", m)
+		t.Error("link position is wrong")
+	}
+}
+
+// TestParseTitleEntities verifies that entities in the title are decoded
+func TestParseTitleEntities(t *testing.T) {
+	parsed, err := parseLinks(strings.NewReader(`<title>Q&amp;A <b></title><title>Second</title>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	title := parsed.Title
+	if title != "Q&A <b>" {
+		t.Logf("got %q", title)
+		t.Error("got wrong title")
+	}
+}
+
+// TestParseBase verifies that we find the first <base href>, and don't report it as a link
+func TestParseBase(t *testing.T) {
+	doc := `<head><base target="_top"><base href="/docs/"><base href="/other/"></head><a href="x.html">x</a>`
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Base != "/docs/" {
+		t.Logf("got %q", parsed.Base)
+		t.Error("got wrong base")
+	}
+	if len(parsed.Links) != 1 {
+		t.Error("base element was reported as a link")
+	}
+}
+
+// TestParseRobotsMeta verifies that robots meta tags and rel attributes are found
+func TestParseRobotsMeta(t *testing.T) {
+	doc := `<head><meta name="ROBOTS" content="noindex"><meta name="docrawler" content="nofollow">
+<meta name="otherbot" content="none"></head><a rel="external NoFollow" href="/x.html">x</a><a href="/y.html">y</a>`
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(parsed.Robots, " ") != "noindex nofollow" {
+		t.Errorf("got robots %v", parsed.Robots)
+	}
+	if len(parsed.Links) != 2 || !parsed.Links[0].nofollow() || parsed.Links[1].nofollow() {
+		t.Error("nofollow links weren't identified")
+	}
+}
+
+// TestLinkNavigational verifies which links are to other pages
+func TestLinkNavigational(t *testing.T) {
+	tests := []struct {
+		link Link
+		want bool
+	}{
+		{Link{Element: "a"}, true},
+		{Link{Element: "area"}, true},
+		{Link{Element: "link", Rel: "next"}, true},
+		{Link{Element: "link", Rel: "stylesheet"}, false},
+		{Link{Element: "link", Rel: "shortcut icon"}, false},
+		{Link{Element: "img"}, false},
+		{Link{Element: "script"}, false},
+	}
+	for _, test := range tests {
+		if got := test.link.navigational(); got != test.want {
+			t.Errorf("%+v: got %v, wanted %v", test.link, got, test.want)
+		}
+	}
+}
+
+// TestParseCanonical verifies that the first canonical link is found, and is still a link
+func TestParseCanonical(t *testing.T) {
+	doc := `<head><link rel="stylesheet" href="/a.css"><link rel="Canonical" href=" /real.html "><link rel="canonical" href="/other.html"></head>`
+	parsed, err := parseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Canonical != "/real.html" {
+		t.Errorf("got canonical %q", parsed.Canonical)
+	}
+	if len(parsed.Links) != 3 {
+		t.Errorf("got %v links, wanted 3", len(parsed.Links))
+	}
+}
@@ -0,0 +1,114 @@
+package docrawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// redirect limits
+const (
+	maxRedirects      = 10 // the most redirects we'll follow before giving up, like net/http
+	redirectLongChain = 3  // chains with more hops than this are reported as too long
+)
+
+// redirect findings, reported for chains which a site should probably fix
+const (
+	findingRedirectLoop = "loop"       // the chain came back around to a URL already in it
+	findingLongChain    = "long-chain" // more than redirectLongChain hops
+	findingDowngrade    = "downgrade"  // a hop went from https to http
+)
+
+// custom errors
+var (
+	errRedirectLoop       = errors.New("redirect loop")
+	errTooManyRedirects   = errors.New("too many redirects")
+	errRedirectOutOfScope = errors.New("redirected out of scope")
+)
+
+// redirect is a single hop in a redirect chain
+type redirect struct {
+	url      *url.URL // the URL which redirected
+	status   int      // its status code, i.e. 301
+	location string   // its Location header, exactly as given
+	to       *url.URL // where the Location header points, resolved against url
+}
+
+// isRedirect returns whether status is a redirect we should follow
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// noRedirects is an http.Client CheckRedirect which stops the client following redirects, so
+// we can follow them ourselves and keep track of each hop
+func noRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// follow fetches u with method (and any extra header), following and recording any
+// redirects. if inScope isn't nil, we won't follow a redirect to any URL it says is out of
+// scope (and return errRedirectOutOfScope instead). the chain is returned even on error, so we
+// can report how we got there.
+func (c *crawler) follow(ctx context.Context, method string, u *url.URL, header http.Header, inScope func(*url.URL) bool) (*http.Response, []redirect, error) {
+	var chain []redirect
+	seen := map[string]bool{u.String(): true}
+	for {
+		resp, err := c.fetch(ctx, method, u, header)
+		if err != nil {
+			return nil, chain, err
+		}
+		location := resp.Header.Get("Location")
+		if !isRedirect(resp.StatusCode) || location == "" {
+			return resp, chain, nil
+		}
+		resp.Body.Close()
+
+		// record this hop, and check we can follow it
+		next, err := u.Parse(location)
+		if err != nil {
+			return nil, chain, err
+		}
+		chain = append(chain, redirect{url: u, status: resp.StatusCode, location: location, to: next})
+		switch {
+		case seen[next.String()]:
+			return nil, chain, errRedirectLoop
+		case len(chain) > maxRedirects:
+			return nil, chain, errTooManyRedirects
+		case inScope != nil && !inScope(next):
+			return nil, chain, errRedirectOutOfScope
+		}
+		seen[next.String()] = true
+		u = next
+	}
+}
+
+// redirectFindings returns any problems with a redirect chain worth reporting
+func redirectFindings(chain []redirect) []string {
+	if len(chain) == 0 {
+		return nil
+	}
+	var findings []string
+	last := chain[len(chain)-1].to.String()
+	for _, r := range chain {
+		if r.url.String() == last {
+			findings = append(findings, findingRedirectLoop)
+			break
+		}
+	}
+	if len(chain) > redirectLongChain {
+		findings = append(findings, findingLongChain)
+	}
+	for _, r := range chain {
+		if r.url.Scheme == "https" && r.to.Scheme == "http" {
+			findings = append(findings, findingDowngrade)
+			break
+		}
+	}
+	return findings
+}
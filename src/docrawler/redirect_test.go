@@ -0,0 +1,122 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// redirectServer returns a test server with a page linking to a simple redirect, a loop, a
+// long chain and a redirect to another host, all but the last ending up at /new
+func redirectServer() *httptest.Server {
+	redirects := map[string]string{
+		"/old":   "/new",
+		"/loop1": "/loop2",
+		"/loop2": "/loop1",
+		"/long1": "/long2",
+		"/long2": "/long3",
+		"/long3": "/long4",
+		"/long4": "/new",
+		"/away":  "http://elsewhere.invalid/",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, to, http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			w.Write([]byte(`<a href="/old">old</a> <a href="/new">new</a> <a href="/loop1">loop</a>
+				<a href="/long1">long</a> <a href="/away">away</a>`))
+			return
+		}
+		w.Write([]byte(`<title>New</title><a href="/">home</a>`))
+	}))
+}
+
+// TestCrawlRedirects verifies that redirects are followed, recorded and deduplicated
+func TestCrawlRedirects(t *testing.T) {
+	ts := redirectServer()
+	defer ts.Close()
+	l := sitemapToLocations(crawlPages(t, context.Background(), ts.URL+"/", Options{Workers: 4, IgnoreRobots: true}))
+
+	// /old and /long1 both end up at /new, which is only one page
+	if len(l) != 2 || l[1].URL != ts.URL+"/new" {
+		t.Fatalf("got %+v", l)
+	}
+	home := l[0]
+	if !reflect.DeepEqual(home.Links, []string{ts.URL + "/new"}) {
+		t.Errorf("got links %v", home.Links)
+	}
+	if !reflect.DeepEqual(home.Broken, []string{ts.URL + "/loop1"}) {
+		t.Errorf("got broken %v", home.Broken)
+	}
+	if !reflect.DeepEqual(home.Remote, []string{"http://elsewhere.invalid/"}) {
+		t.Errorf("got remote %v", home.Remote)
+	}
+
+	// and every redirect is reported, with its findings
+	want := []Redirect{
+		{
+			From: ts.URL + "/away", To: "http://elsewhere.invalid/",
+			Hops: []Hop{{ts.URL + "/away", 301, "http://elsewhere.invalid/"}},
+		},
+		{
+			From: ts.URL + "/long1", To: ts.URL + "/new",
+			Hops: []Hop{
+				{ts.URL + "/long1", 301, "/long2"},
+				{ts.URL + "/long2", 301, "/long3"},
+				{ts.URL + "/long3", 301, "/long4"},
+				{ts.URL + "/long4", 301, "/new"},
+			},
+			Findings: []string{findingLongChain},
+		},
+		{
+			From: ts.URL + "/loop1", To: ts.URL + "/loop1",
+			Hops: []Hop{
+				{ts.URL + "/loop1", 301, "/loop2"},
+				{ts.URL + "/loop2", 301, "/loop1"},
+			},
+			Findings: []string{findingRedirectLoop},
+		},
+		{
+			From: ts.URL + "/old", To: ts.URL + "/new",
+			Hops: []Hop{{ts.URL + "/old", 301, "/new"}},
+		},
+	}
+	if !reflect.DeepEqual(home.Redirects, want) {
+		t.Errorf("got redirects %+v, wanted %+v", home.Redirects, want)
+	}
+}
+
+// TestRedirectFindings tests each of the problems we look for in a redirect chain
+func TestRedirectFindings(t *testing.T) {
+	hop := func(from, to string) redirect {
+		u, _ := url.Parse(from)
+		v, _ := url.Parse(to)
+		return redirect{url: u, status: http.StatusMovedPermanently, location: to, to: v}
+	}
+	tests := []struct {
+		chain []redirect
+		want  []string
+	}{
+		{nil, nil},
+		{[]redirect{hop("http://a.com/", "https://a.com/")}, nil},
+		{[]redirect{hop("https://a.com/", "http://a.com/")}, []string{findingDowngrade}},
+		{[]redirect{hop("http://a.com/1", "http://a.com/2"), hop("http://a.com/2", "http://a.com/1")}, []string{findingRedirectLoop}},
+		{[]redirect{
+			hop("https://a.com/1", "https://a.com/2"),
+			hop("https://a.com/2", "http://a.com/3"),
+			hop("http://a.com/3", "http://a.com/4"),
+			hop("http://a.com/4", "http://a.com/5"),
+		}, []string{findingLongChain, findingDowngrade}},
+	}
+	for i, test := range tests {
+		if got := redirectFindings(test.chain); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, wanted %v", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCheckRemote verifies that remote links are each checked once, with their own limited
+// number of workers, and never crawled
+func TestCheckRemote(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	inFlight, maxInFlight := 0, 0
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path]++
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		switch r.URL.Path {
+		case "/missing", "/robots.txt":
+			w.WriteHeader(http.StatusNotFound)
+		case "/nohead":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			fallthrough
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/never">never crawled</a>`))
+		}
+	}))
+	defer remote.Close()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/other.html">other</a>
+			<a href="` + remote.URL + `/ok">ok</a> <a href="` + remote.URL + `/ok#again">ok</a>
+			<a href="` + remote.URL + `/missing">missing</a> <a href="` + remote.URL + `/nohead">no head</a>`))
+	}))
+	defer site.Close()
+
+	for _, check := range []bool{false, true} {
+		requests = make(map[string]int)
+		opts := Options{Workers: 4, RemoteWorkers: 1, IgnoreRobots: true, CheckRemote: check}
+		l := sitemapToLocations(crawlPages(t, context.Background(), site.URL+"/", opts))
+		if len(l) != 2 {
+			t.Fatalf("got %+v", l)
+		}
+
+		if !check {
+			// remote links are just reported, without checking them
+			if len(requests) != 0 || len(l[0].Remote) != 4 {
+				t.Errorf("got requests %v, remote %v", requests, l[0].Remote)
+			}
+			continue
+		}
+
+		// both pages link to each remote URL, but they're each only checked once
+		want := map[string]int{"HEAD /ok": 1, "HEAD /missing": 1, "HEAD /nohead": 1, "GET /nohead": 1}
+		if !reflect.DeepEqual(requests, want) {
+			t.Errorf("got requests %v, wanted %v", requests, want)
+		}
+		if maxInFlight > 1 {
+			t.Errorf("got %v remote checks at once, wanted 1", maxInFlight)
+		}
+		for _, loc := range l {
+			wantRemote := []string{remote.URL + "/nohead", remote.URL + "/ok", remote.URL + "/ok#again"}
+			if !reflect.DeepEqual(loc.Remote, wantRemote) {
+				t.Errorf("%v: got remote %v", loc.URL, loc.Remote)
+			}
+			if !reflect.DeepEqual(loc.Broken, []string{remote.URL + "/missing"}) ||
+				len(loc.BrokenStatus) != 1 || loc.BrokenStatus[0].Code != http.StatusNotFound {
+				t.Errorf("%v: got broken %v %+v", loc.URL, loc.Broken, loc.BrokenStatus)
+			}
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package docrawler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robotsUserAgent is the product token we look for in robots.txt User-agent lines
+const robotsUserAgent = "docrawler"
+
+// robotsMaxSize is how much of a robots.txt we'll read (RFC 9309 says at least 500 KiB)
+const robotsMaxSize = 500 * 1024
+
+// robots directives (from <meta name="robots"> and X-Robots-Tag) that we act on
+const (
+	directiveNoindex  = "noindex"
+	directiveNofollow = "nofollow"
+	directiveNone     = "none" // same as noindex, nofollow
+)
+
+// robotsTagDirectives are directives which take a value after a ':', so we don't mistake
+// them for a user agent prefix in an X-Robots-Tag header
+var robotsTagDirectives = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// robotsRule is a single Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+	re      *regexp.Regexp
+}
+
+// robotsGroup is a set of rules which apply to one or more user agents
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsTxt is a parsed robots.txt file
+type robotsTxt struct {
+	groups   []*robotsGroup
+	sitemaps []string
+	allowAll bool // i.e. there was no robots.txt
+	denyAll  bool // i.e. the server errored fetching robots.txt
+}
+
+// parseRobots parses a robots.txt file. it's lenient, like the spec asks, and just skips
+// anything it doesn't understand.
+func parseRobots(r io.Reader) *robotsTxt {
+	rt := &robotsTxt{}
+	var group *robotsGroup
+	inAgents := false // true while we're reading a run of User-agent lines
+
+	scanner := bufio.NewScanner(io.LimitReader(r, robotsMaxSize))
+	for scanner.Scan() {
+		// strip comments and split into key: value
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			// consecutive User-agent lines all share the group that follows them
+			if !inAgents {
+				group = &robotsGroup{}
+				rt.groups = append(rt.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil || value == "" {
+				// rules outside a group are meaningless, and an empty Disallow allows everything
+				continue
+			}
+			re, err := robotsPatternToRegexp(value)
+			if err != nil {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value, re: re})
+
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(value, 64); err == nil && secs >= 0 {
+				group.crawlDelay = time.Duration(secs * float64(time.Second))
+			}
+
+		case "sitemap":
+			// sitemaps aren't part of any group
+			rt.sitemaps = append(rt.sitemaps, value)
+
+		default:
+			inAgents = false
+		}
+	}
+	return rt
+}
+
+// robotsPatternToRegexp converts a robots.txt path pattern, which may contain '*' wildcards
+// and a trailing '$' anchor, into an equivalent regexp
+func robotsPatternToRegexp(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.Compile(expr)
+}
+
+// groupFor returns the rules that apply to userAgent: those of every group naming it, or
+// failing that, those of every "*" group
+func (rt *robotsTxt) groupFor(userAgent string) *robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+	var named, star robotsGroup
+	foundNamed, foundStar := false, false
+	for _, g := range rt.groups {
+		for _, a := range g.agents {
+			if a == userAgent {
+				named.rules = append(named.rules, g.rules...)
+				named.crawlDelay = g.crawlDelay
+				foundNamed = true
+			} else if a == "*" {
+				star.rules = append(star.rules, g.rules...)
+				star.crawlDelay = g.crawlDelay
+				foundStar = true
+			}
+		}
+	}
+	if foundNamed {
+		return &named
+	}
+	if foundStar {
+		return &star
+	}
+	return nil
+}
+
+// allowed returns whether userAgent may fetch the URL u. the most specific (longest)
+// matching rule wins, and Allow wins a tie.
+func (rt *robotsTxt) allowed(userAgent string, u *url.URL) bool {
+	if rt.denyAll {
+		return false
+	}
+	if rt.allowAll || u.Path == "/robots.txt" {
+		return true
+	}
+	g := rt.groupFor(userAgent)
+	if g == nil {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allow, length := true, -1
+	for _, r := range g.rules {
+		if !r.re.MatchString(path) {
+			continue
+		}
+		if len(r.pattern) > length || (len(r.pattern) == length && r.allow) {
+			allow, length = r.allow, len(r.pattern)
+		}
+	}
+	return allow
+}
+
+// crawlDelay returns the Crawl-delay that applies to userAgent, or 0 if there isn't one
+func (rt *robotsTxt) crawlDelay(userAgent string) time.Duration {
+	g := rt.groupFor(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// parseRobotsTag parses the comma separated directives in a robots <meta> tag or X-Robots-Tag
+// header, returning them in lower case. a header may be prefixed with a user agent (i.e.
+// "googlebot: noindex"), in which case it's ignored unless it's for us.
+func parseRobotsTag(value string) []string {
+	if i := strings.Index(value, ":"); i >= 0 {
+		prefix := strings.ToLower(strings.TrimSpace(value[:i]))
+		if !robotsTagDirectives[prefix] && !strings.Contains(prefix, ",") {
+			if prefix != robotsUserAgent {
+				return nil
+			}
+			value = value[i+1:]
+		}
+	}
+
+	var directives []string
+	for _, d := range strings.Split(value, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			directives = append(directives, d)
+		}
+	}
+	return directives
+}
+
+// fetchRobots GETs and parses the robots.txt for the host of u. following RFC 9309, a
+// missing robots.txt (4xx) allows everything, and one the server errors on (5xx) disallows
+// everything. if we can't reach the host at all we allow everything too, so the page fetch
+// fails the same way and the page is reported broken, with why, rather than blocked. that's
+// only for now though, so we return the error too, and the next page tries again.
+func fetchRobots(ctx context.Context, client *http.Client, u *url.URL) (*robotsTxt, error) {
+	robotsURL := url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return &robotsTxt{denyAll: true}, nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &robotsTxt{allowAll: true}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return parseRobots(resp.Body), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return &robotsTxt{allowAll: true}, nil
+	}
+	return &robotsTxt{denyAll: true}, nil
+}
+
+// robotsCache holds the robots.txt for each host we've seen, so we only fetch each once (or
+// until we manage to)
+type robotsCache struct {
+	client *http.Client
+	mu     sync.Mutex
+	hosts  map[string]*robotsEntry
+}
+
+// robotsEntry is a single host's robots.txt, once we've got it
+type robotsEntry struct {
+	mu     sync.Mutex
+	robots *robotsTxt
+}
+
+// newRobotsCache returns an empty robotsCache which fetches with client
+func newRobotsCache(client *http.Client) *robotsCache {
+	return &robotsCache{client: client, hosts: make(map[string]*robotsEntry)}
+}
+
+// get returns the robots.txt for the host of u, fetching it if we haven't already
+func (rc *robotsCache) get(ctx context.Context, u *url.URL) *robotsTxt {
+	key := u.Scheme + "://" + u.Host
+	rc.mu.Lock()
+	e, ok := rc.hosts[key]
+	if !ok {
+		e = &robotsEntry{}
+		rc.hosts[key] = e
+	}
+	rc.mu.Unlock()
+
+	// fetch outside the lock so other hosts aren't held up, but only once per host. if we
+	// couldn't reach it, that result is only for this page, so it isn't kept
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.robots != nil {
+		return e.robots
+	}
+	robots, err := fetchRobots(ctx, rc.client, u)
+	if err == nil {
+		e.robots = robots
+	}
+	return robots
+}
@@ -0,0 +1,213 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRobots is a robots.txt with a little of everything in it
+const testRobots = `# comment
+User-agent: otherbot
+Disallow: /
+
+User-agent: DoCrawler
+User-agent: anotherbot
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.pdf$
+Disallow: /search?
+Crawl-delay: 1.5
+
+User-agent: *
+Disallow: /everyone/
+
+Sitemap: http://a.com/sitemap.xml
+`
+
+// doRobotsTest checks whether rawurl is allowed for userAgent
+func doRobotsTest(t *testing.T, rt *robotsTxt, userAgent, rawurl string, wanted bool) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.allowed(userAgent, u) != wanted {
+		t.Errorf("%v for %q: got %v, wanted %v", userAgent, rawurl, !wanted, wanted)
+	}
+}
+
+// TestRobotsRules verifies group selection and rule precedence
+func TestRobotsRules(t *testing.T) {
+	rt := parseRobots(strings.NewReader(testRobots))
+	doRobotsTest(t, rt, "docrawler", "http://a.com/", true)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/private/x.html", false)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/private/public.html", true)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/docs/manual.pdf", false)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/docs/manual.pdf?x=1", true)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/search?q=1", false)
+	doRobotsTest(t, rt, "docrawler", "http://a.com/everyone/", true)
+	doRobotsTest(t, rt, "somebot", "http://a.com/everyone/", false)
+	doRobotsTest(t, rt, "somebot", "http://a.com/private/x.html", true)
+	doRobotsTest(t, rt, "otherbot", "http://a.com/", false)
+	doRobotsTest(t, rt, "otherbot", "http://a.com/robots.txt", true)
+}
+
+// TestRobotsExtras verifies Crawl-delay and Sitemap parsing
+func TestRobotsExtras(t *testing.T) {
+	rt := parseRobots(strings.NewReader(testRobots))
+	if d := rt.crawlDelay("docrawler"); d != 1500*time.Millisecond {
+		t.Errorf("got crawl delay %v", d)
+	}
+	if d := rt.crawlDelay("somebot"); d != 0 {
+		t.Errorf("got crawl delay %v", d)
+	}
+	if len(rt.sitemaps) != 1 || rt.sitemaps[0] != "http://a.com/sitemap.xml" {
+		t.Error("sitemap not found")
+	}
+}
+
+// TestRobotsBlocked verifies that crawlItem honors robots.txt, unless told not to
+func TestRobotsBlocked(t *testing.T) {
+	page, err := newHTTPItem(nil, baseURL+"private/secret.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.linkType != tBlocked {
+		t.Error("page disallowed by robots.txt wasn't blocked")
+	}
+
+	page, err = newHTTPItem(nil, baseURL+"private/secret.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.IgnoreRobots = true
+	page.crawlItem(context.Background(), newCrawler(opts))
+	if page.linkType != tHTMLPage || page.title != "Secret" {
+		t.Error("page wasn't crawled with robots.txt ignored")
+	}
+}
+
+// TestRobotsUnavailable verifies that a missing robots.txt allows everything, and an
+// unreachable one disallows everything
+func TestRobotsUnavailable(t *testing.T) {
+	for status, wanted := range map[int]bool{http.StatusNotFound: true, http.StatusServiceUnavailable: false} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		u, _ := url.Parse(ts.URL + "/page.html")
+		if robots, _ := fetchRobots(context.Background(), http.DefaultClient, u); robots.allowed(robotsUserAgent, u) != wanted {
+			t.Errorf("robots.txt status %v should give allowed = %v", status, wanted)
+		}
+		ts.Close()
+	}
+}
+
+// TestRobotsUnreachable verifies that a host we can't reach at all is reported broken, with
+// why, rather than blocked by the robots.txt we couldn't fetch
+func TestRobotsUnreachable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	page, err := newHTTPItem(nil, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.linkType != tBroken || page.status == nil || page.status.class != classRefused {
+		t.Errorf("got type %v, status %+v", page.linkType, page.status)
+	}
+}
+
+// TestRobotsRetry verifies that a robots.txt we couldn't get isn't remembered, so once the
+// host is back its rules apply
+func TestRobotsRetry(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			// drop the connection, as a host which has gone away would
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+	}))
+	defer ts.Close()
+
+	rc := newRobotsCache(ts.Client())
+	u, _ := url.Parse(ts.URL + "/private/page.html")
+	if !rc.get(context.Background(), u).allowed(robotsUserAgent, u) {
+		t.Error("an unreachable robots.txt should allow the page, so its fetch fails")
+	}
+	fail.Store(false)
+	if rc.get(context.Background(), u).allowed(robotsUserAgent, u) {
+		t.Error("robots.txt wasn't fetched again once the host was back")
+	}
+}
+
+// TestParseRobotsTag verifies parsing of robots meta tags and X-Robots-Tag headers
+func TestParseRobotsTag(t *testing.T) {
+	tests := map[string]string{
+		"noindex, NoFollow":                        "noindex nofollow",
+		"docrawler: noindex":                       "noindex",
+		"googlebot: noindex":                       "",
+		"unavailable_after: 25 Jun 2010 15:00 PST": "unavailable_after: 25 jun 2010 15:00 pst",
+		"max-snippet: 20, nofollow":                "max-snippet: 20 nofollow",
+		"":                                         "",
+	}
+	for value, wanted := range tests {
+		if got := strings.Join(parseRobotsTag(value), " "); got != wanted {
+			t.Errorf("%q: got %q, wanted %q", value, got, wanted)
+		}
+	}
+}
+
+// TestXRobotsTag verifies that X-Robots-Tag headers apply to the page, and its links to
+// other pages (but not its images and stylesheets)
+func TestXRobotsTag(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Add("X-Robots-Tag", "otherbot: noindex")
+		w.Header().Add("X-Robots-Tag", "docrawler: nofollow")
+		w.Write([]byte(`<link rel="stylesheet" href="/style.css"><a href="/other.html">other</a><img src="/image.png">`))
+	}))
+	defer ts.Close()
+
+	page, err := newHTTPItem(nil, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if !page.indexable() {
+		t.Error("page shouldn't be noindex, that was for another bot")
+	}
+	if len(page.children) != 3 || page.children[0].nofollow || !page.children[1].nofollow || page.children[2].nofollow {
+		t.Error("only the page's links to other pages should be nofollow")
+	}
+}
+
+// TestXRobotsTagOnce verifies that a page checked with a HEAD before its GET only gets the
+// directives in its headers once
+func TestXRobotsTagOnce(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}))
+	defer ts.Close()
+
+	page, err := newHTTPItem(nil, ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.element = "img"
+	page.crawlItem(context.Background(), newCrawler(DefaultOptions()))
+	if page.method != http.MethodGet || strings.Join(page.robots, " ") != "noindex" {
+		t.Errorf("got %v with directives %q", page.method, page.robots)
+	}
+}
@@ -0,0 +1,141 @@
+package docrawler
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// scope decision reasons, which say which rule decided whether a URL is in scope
+const (
+	reasonSeed      = "seed"                        // the URL we started crawling from
+	reasonSameHost  = "same host"                   // on the seed's host
+	reasonWWW       = "same host (www)"             // on the seed's host, give or take a "www."
+	reasonHostGlob  = "host matches"                // on a host matching one of the host globs
+	reasonOtherHost = "other host"                  // on any other host, i.e. remote
+	reasonPath      = "path not under"              // outside all of the path prefixes
+	reasonExclude   = "excluded by"                 // matched an exclude pattern
+	reasonNoInclude = "not included by any pattern" // didn't match any include pattern
+	reasonInclude   = "included by"                 // matched an include pattern
+)
+
+// ScopeOptions holds everything configurable about which URLs we crawl. by default, that's
+// everything on the seed's host
+type ScopeOptions struct {
+	Hosts        []string         // globs of other hosts to crawl, i.e. "*.example.com"
+	SameWWW      bool             // treat www.example.com and example.com as the same host
+	PathPrefixes []string         // only crawl paths starting with one of these, if there are any
+	Include      []*regexp.Regexp // only crawl URLs matching one of these, if there are any
+	Exclude      []*regexp.Regexp // never crawl URLs matching any of these
+}
+
+// scope decides which URLs are part of the site we're crawling, relative to the seed URL
+type scope struct {
+	seed *url.URL
+	opts ScopeOptions
+}
+
+// scopeDecision is whether a URL is in scope, and why
+type scopeDecision struct {
+	out    bool   // out of scope, so we don't crawl it
+	reason string // one of the reason* constants
+	rule   string // the glob, prefix or pattern the reason refers to, if any
+}
+
+// newScope returns the scope of a crawl starting at seed
+func newScope(seed *url.URL, opts ScopeOptions) *scope {
+	return &scope{seed: seed, opts: opts}
+}
+
+// String returns the decision in a form for humans, i.e. "out: excluded by \.pdf$"
+func (d scopeDecision) String() string {
+	s := "in"
+	if d.out {
+		s = "out"
+	}
+	if d.reason != "" {
+		s += ": " + d.reason
+	}
+	if d.rule != "" {
+		s += " " + d.rule
+	}
+	return s
+}
+
+// itemType returns the type of an item which is out of scope for this reason
+func (d scopeDecision) itemType() itemType {
+	if d.reason == reasonOtherHost {
+		return tRemote
+	}
+	return tOutOfScope
+}
+
+// stripWWW returns host without a leading "www."
+func stripWWW(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// check decides whether u is in scope. a nil scope has everything in it.
+func (s *scope) check(u *url.URL) scopeDecision {
+	if s == nil {
+		return scopeDecision{}
+	}
+
+	// it has to be on one of our hosts
+	var in scopeDecision
+	switch {
+	case strings.EqualFold(u.Host, s.seed.Host):
+		in = scopeDecision{reason: reasonSameHost}
+	case s.opts.SameWWW && stripWWW(u.Host) == stripWWW(s.seed.Host):
+		in = scopeDecision{reason: reasonWWW}
+	default:
+		in = scopeDecision{out: true, reason: reasonOtherHost}
+		for _, glob := range s.opts.Hosts {
+			// globs with a port match the port too
+			host := u.Hostname()
+			if strings.Contains(glob, ":") {
+				host = u.Host
+			}
+			if ok, _ := path.Match(strings.ToLower(glob), strings.ToLower(host)); ok {
+				in = scopeDecision{reason: reasonHostGlob, rule: glob}
+				break
+			}
+		}
+		if in.out {
+			return in
+		}
+	}
+
+	// and under one of our paths
+	if len(s.opts.PathPrefixes) > 0 {
+		under := false
+		for _, prefix := range s.opts.PathPrefixes {
+			if strings.HasPrefix(u.Path, prefix) {
+				under = true
+				break
+			}
+		}
+		if !under {
+			return scopeDecision{out: true, reason: reasonPath, rule: strings.Join(s.opts.PathPrefixes, ", ")}
+		}
+	}
+
+	// and not excluded
+	for _, re := range s.opts.Exclude {
+		if re.MatchString(u.String()) {
+			return scopeDecision{out: true, reason: reasonExclude, rule: re.String()}
+		}
+	}
+
+	// and included, if we're only including some
+	if len(s.opts.Include) == 0 {
+		return in
+	}
+	for _, re := range s.opts.Include {
+		if re.MatchString(u.String()) {
+			return scopeDecision{reason: reasonInclude, rule: re.String()}
+		}
+	}
+	return scopeDecision{out: true, reason: reasonNoInclude}
+}
@@ -0,0 +1,110 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// TestScopeCheck tests each of our scope rules
+func TestScopeCheck(t *testing.T) {
+	seed, _ := url.Parse("https://example.com/docs/")
+	s := newScope(seed, ScopeOptions{
+		Hosts:        []string{"*.example.com", "api.other.com:8443"},
+		SameWWW:      true,
+		PathPrefixes: []string{"/docs/", "/api/"},
+		Include:      []*regexp.Regexp{regexp.MustCompile(`/(docs|api)/v[0-9]/`), regexp.MustCompile(`\.html$`)},
+		Exclude:      []*regexp.Regexp{regexp.MustCompile(`\.pdf$`)},
+	})
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/docs/v1/", "in: included by /(docs|api)/v[0-9]/"},
+		{"https://EXAMPLE.com/docs/intro.html", `in: included by \.html$`},
+		{"https://www.example.com/docs/v2/", "in: included by /(docs|api)/v[0-9]/"},
+		{"https://a.b.example.com/api/v1/x", "in: included by /(docs|api)/v[0-9]/"},
+		{"https://api.other.com:8443/api/v3/", "in: included by /(docs|api)/v[0-9]/"},
+		{"https://api.other.com/api/v3/", "out: other host"},
+		{"https://example.org/docs/v1/", "out: other host"},
+		{"https://example.com/blog/v1/", "out: path not under /docs/, /api/"},
+		{"https://example.com/docs/v1/guide.pdf", `out: excluded by \.pdf$`},
+		{"https://example.com/docs/guide.txt", "out: not included by any pattern"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.check(u).String(); got != test.want {
+			t.Errorf("%v: got %q, wanted %q", test.url, got, test.want)
+		}
+	}
+
+	// by default, it's just the seed's host
+	s = newScope(seed, ScopeOptions{})
+	for rawurl, want := range map[string]string{
+		"https://example.com/anything":  "in: same host",
+		"http://example.com/":           "in: same host",
+		"https://www.example.com/docs/": "out: other host",
+		"https://sub.example.com/docs/": "out: other host",
+	} {
+		u, _ := url.Parse(rawurl)
+		if got := s.check(u).String(); got != want {
+			t.Errorf("%v: got %q, wanted %q", rawurl, got, want)
+		}
+	}
+}
+
+// TestCrawlScope verifies that scope is relative to the seed (not the referring page), and
+// that out of scope links are reported but not crawled
+func TestCrawlScope(t *testing.T) {
+	var other *httptest.Server
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="/docs/a.html">a</a> <a href="/blog/">blog</a> <a href="/docs/b.pdf">pdf</a>
+			<a href="` + other.URL + `/docs/">other</a>`))
+	}))
+	defer site.Close()
+	other = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// this links back to the site, which would be remote if scope were relative to this page
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<a href="` + site.URL + `/docs/c.html">c</a>`))
+	}))
+	defer other.Close()
+
+	opts := Options{Workers: 4, IgnoreRobots: true, Scope: ScopeOptions{
+		Hosts:        []string{"127.0.0.1:*"},
+		PathPrefixes: []string{"/docs/"},
+		Exclude:      []*regexp.Regexp{regexp.MustCompile(`\.pdf$`)},
+	}}
+	l := sitemapToLocations(crawlPages(t, context.Background(), site.URL+"/docs/", opts))
+	var urls []string
+	for _, loc := range l {
+		urls = append(urls, loc.URL)
+	}
+	want := []string{site.URL + "/docs/", site.URL + "/docs/a.html", site.URL + "/docs/c.html", other.URL + "/docs/"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(urls, want) {
+		t.Fatalf("got %v, wanted %v", urls, want)
+	}
+	var home *Location
+	for _, loc := range l {
+		if loc.URL == site.URL+"/docs/" {
+			home = loc
+		}
+	}
+	if !reflect.DeepEqual(home.OutOfScope, []string{site.URL + "/blog/", site.URL + "/docs/b.pdf"}) {
+		t.Errorf("got out of scope %v", home.OutOfScope)
+	}
+	if home.Scope[site.URL+"/blog/"] != "out: path not under /docs/" ||
+		home.Scope[site.URL+"/docs/b.pdf"] != `out: excluded by \.pdf$` ||
+		home.Scope[other.URL+"/docs/"] != "in: host matches 127.0.0.1:*" {
+		t.Errorf("got scope %v", home.Scope)
+	}
+}
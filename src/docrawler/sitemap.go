@@ -0,0 +1,246 @@
+package docrawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sitemap limits, from https://www.sitemaps.org/protocol.html
+const (
+	sitemapMaxURLs  = 50000
+	sitemapMaxBytes = 50 * 1024 * 1024
+)
+
+// sitemapMaxFiles is the most sitemap files we'll read when seeding a crawl, so a huge (or
+// looping) tree of sitemap indexes can't keep us busy forever
+const sitemapMaxFiles = 1000
+
+// custom errors
+var (
+	errSitemapFetch = errors.New("couldn't fetch sitemap")
+)
+
+// sitemapNamespace is the XML namespace of both urlsets and sitemap indexes
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapIndexName is the name of the top level sitemap file, which is either the only urlset
+// or the index of all of them
+const sitemapIndexName = "sitemap.xml"
+
+// sitemapURL is a single <url> entry in a urlset
+type sitemapURL struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+// sitemapRef is a single <sitemap> entry in a sitemap index
+type sitemapRef struct {
+	XMLName xml.Name `xml:"sitemap"`
+	Loc     string   `xml:"loc"`
+}
+
+// sitemapFile is a single generated sitemap file
+type sitemapFile struct {
+	name string
+	data string
+}
+
+// sitemapHeader and sitemapFooter wrap the entries of a sitemap file of the given root element
+func sitemapHeader(root string) string {
+	return xml.Header + "<" + root + " xmlns=\"" + sitemapNamespace + "\">\n"
+}
+func sitemapFooter(root string) string {
+	return "</" + root + ">\n"
+}
+
+// sitemapEntry marshals a single <url> or <sitemap> entry
+func sitemapEntry(v interface{}) (string, error) {
+	b, err := xml.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// locationsToSitemaps converts the indexable pages in a *Location slice into a sitemaps.org
+// XML sitemap. if it fits in a single file (no more than maxURLs URLs, and maxBytes bytes)
+// that's all we return. otherwise we split it into as many files as needed, and add a sitemap
+// index (named sitemapIndexName, and always the first file returned) which points to each of
+// them under rootURL.
+func locationsToSitemaps(locations []*Location, rootURL string, maxURLs, maxBytes int) ([]sitemapFile, error) {
+	const root = "urlset"
+	header, footer := sitemapHeader(root), sitemapFooter(root)
+
+	// build up urlset files, starting a new one whenever we'd go over a limit
+	var parts []sitemapFile
+	var b strings.Builder
+	count := 0
+	flush := func() {
+		b.WriteString(footer)
+		parts = append(parts, sitemapFile{data: b.String()})
+		b.Reset()
+		count = 0
+	}
+	b.WriteString(header)
+	for _, l := range locations {
+		// pages which don't want to be indexed don't belong in a sitemap
+		if !l.Indexable {
+			continue
+		}
+		entry, err := sitemapEntry(sitemapURL{Loc: l.URL, LastMod: l.LastModified})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 && (count >= maxURLs || b.Len()+len(entry)+len(footer) > maxBytes) {
+			flush()
+			b.WriteString(header)
+		}
+		b.WriteString(entry)
+		count++
+	}
+	flush()
+
+	// it all fit, so no need for an index
+	if len(parts) == 1 {
+		parts[0].name = sitemapIndexName
+		return parts, nil
+	}
+
+	// otherwise, name each part and point to it from an index
+	base, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, err
+	}
+	const indexRoot = "sitemapindex"
+	var index strings.Builder
+	index.WriteString(sitemapHeader(indexRoot))
+	for i := range parts {
+		parts[i].name = fmt.Sprintf("sitemap-%d.xml", i+1)
+		entry, err := sitemapEntry(sitemapRef{Loc: base.ResolveReference(&url.URL{Path: parts[i].name}).String()})
+		if err != nil {
+			return nil, err
+		}
+		index.WriteString(entry)
+	}
+	index.WriteString(sitemapFooter(indexRoot))
+	return append([]sitemapFile{{name: sitemapIndexName, data: index.String()}}, parts...), nil
+}
+
+// sitemapRootURL returns the URL of the root of the site the locations came from, which is
+// where we assume the sitemap will live
+func sitemapRootURL(locations []*Location) string {
+	if len(locations) == 0 {
+		return "/"
+	}
+	u, err := url.Parse(locations[0].URL)
+	if err != nil {
+		return "/"
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+// parseSitemap reads a urlset or sitemap index, returning the page URLs (from a urlset) and
+// the sitemap URLs (from an index) in it. it's lenient, and returns whatever it found before
+// any error.
+func parseSitemap(r io.Reader) ([]string, []string, error) {
+	var pages, sitemaps []string
+	var stack []string // names of the elements we're inside of
+	var loc strings.Builder
+
+	d := xml.NewDecoder(io.LimitReader(r, sitemapMaxBytes))
+	d.Strict = false
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return pages, sitemaps, nil
+		}
+		if err != nil {
+			return pages, sitemaps, err
+		}
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			loc.Reset()
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1] == "loc" {
+				loc.Write(t)
+			}
+		case xml.EndElement:
+			// a <loc> belongs to whichever of <url> or <sitemap> it's inside
+			if t.Name.Local == "loc" && len(stack) >= 2 {
+				switch stack[len(stack)-2] {
+				case "url":
+					pages = append(pages, strings.TrimSpace(loc.String()))
+				case "sitemap":
+					sitemaps = append(sitemaps, strings.TrimSpace(loc.String()))
+				}
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// fetchSitemap GETs a single sitemap (following any redirects), which may be gzipped, and parses it
+func (c *crawler) fetchSitemap(ctx context.Context, u *url.URL) ([]string, []string, error) {
+	resp, _, err := c.follow(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errSitemapFetch
+	}
+
+	// sitemaps are often served as .xml.gz files, which the http client doesn't decompress
+	// for us since that's their content, not their encoding. so sniff for the gzip magic number
+	var r io.Reader = bufio.NewReader(resp.Body)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return parseSitemap(r)
+}
+
+// sitemapSeeds finds every page listed in the sitemaps for the site at home: those named by
+// its robots.txt, and /sitemap.xml, following any sitemap indexes
+func (c *crawler) sitemapSeeds(ctx context.Context, home *url.URL) []string {
+	// start with the sitemaps robots.txt tells us about, and the usual location
+	queue := append([]string{}, c.robots.get(ctx, home).sitemaps...)
+	queue = append(queue, home.ResolveReference(&url.URL{Path: "/" + sitemapIndexName}).String())
+
+	seen := make(map[string]bool)
+	var pages []string
+	for len(queue) > 0 && len(seen) < sitemapMaxFiles && ctx.Err() == nil {
+		rawurl := queue[0]
+		queue = queue[1:]
+		if seen[rawurl] {
+			continue
+		}
+		seen[rawurl] = true
+
+		u, err := resolveURL(home.String(), rawurl)
+		if err != nil {
+			continue
+		}
+		found, sitemaps, _ := c.fetchSitemap(ctx, u)
+		pages = append(pages, found...)
+		queue = append(queue, sitemaps...)
+	}
+	return uniqStrings(pages)
+}
@@ -0,0 +1,121 @@
+package docrawler
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testSitemapLocations is a small site map to convert to an XML sitemap
+var testSitemapLocations = []*Location{
+	{URL: "http://a.com/", LastModified: "2015-02-17T00:00:00Z", Indexable: true},
+	{URL: "http://a.com/about.html?a=1&b=2", Indexable: true},
+	{URL: "http://a.com/docs/", Indexable: true},
+	{URL: "http://a.com/secret.html", Indexable: false},
+}
+
+// TestSitemapSingle verifies that a small sitemap is a single valid urlset
+func TestSitemapSingle(t *testing.T) {
+	files, err := locationsToSitemaps(testSitemapLocations, "http://a.com/", sitemapMaxURLs, sitemapMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].name != sitemapIndexName {
+		t.Fatalf("got %v files, wanted just %v", len(files), sitemapIndexName)
+	}
+
+	// make sure it parses back into what we put in
+	var urlset struct {
+		XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+	if err := xml.Unmarshal([]byte(files[0].data), &urlset); err != nil {
+		t.Fatal(err)
+	}
+	if len(urlset.URLs) != 3 {
+		t.Fatalf("got %v URLs, wanted 3", len(urlset.URLs))
+	}
+	if urlset.URLs[0].Loc != "http://a.com/" || urlset.URLs[0].LastMod != "2015-02-17T00:00:00Z" {
+		t.Errorf("got %+v", urlset.URLs[0])
+	}
+	if urlset.URLs[1].Loc != "http://a.com/about.html?a=1&b=2" || urlset.URLs[1].LastMod != "" {
+		t.Errorf("got %+v", urlset.URLs[1])
+	}
+	if !strings.Contains(files[0].data, "a=1&amp;b=2") {
+		t.Error("URL wasn't entity escaped")
+	}
+}
+
+// TestSitemapSplit verifies that we split into multiple files plus an index when over a limit
+func TestSitemapSplit(t *testing.T) {
+	files, err := locationsToSitemaps(testSitemapLocations, "http://a.com/maps/", 2, sitemapMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %v files, wanted 3", len(files))
+	}
+	if !strings.Contains(files[0].data, "<sitemapindex") || !strings.Contains(files[0].data, "<loc>http://a.com/maps/sitemap-2.xml</loc>") {
+		t.Error("sitemap index is wrong")
+	}
+	if strings.Count(files[1].data, "<url>") != 2 || strings.Count(files[2].data, "<url>") != 1 {
+		t.Error("URLs weren't split correctly")
+	}
+
+	// and by size
+	files, err = locationsToSitemaps(testSitemapLocations, "http://a.com/", sitemapMaxURLs, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files[1:] {
+		if len(f.data) > 300 {
+			t.Errorf("%v is %v bytes, over the limit", f.name, len(f.data))
+		}
+	}
+	if len(files) < 3 {
+		t.Error("sitemap wasn't split by size")
+	}
+}
+
+// TestParseSitemap verifies we can read both urlsets and sitemap indexes
+func TestParseSitemap(t *testing.T) {
+	pages, sitemaps, err := parseSitemap(strings.NewReader(`<?xml version="1.0"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc> http://a.com/one.xml </loc></sitemap>
+  <sitemap><loc>http://a.com/two.xml.gz</loc><lastmod>2015-02-17</lastmod></sitemap>
+</sitemapindex>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 0 || len(sitemaps) != 2 || sitemaps[0] != "http://a.com/one.xml" {
+		t.Errorf("got pages %v, sitemaps %v", pages, sitemaps)
+	}
+
+	// and round trip one of our own
+	files, err := locationsToSitemaps(testSitemapLocations, "http://a.com/", sitemapMaxURLs, sitemapMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, sitemaps, err = parseSitemap(strings.NewReader(files[0].data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 || len(sitemaps) != 0 || pages[1] != "http://a.com/about.html?a=1&b=2" {
+		t.Errorf("got pages %v, sitemaps %v", pages, sitemaps)
+	}
+}
+
+// TestSitemapSeeds verifies we find sitemaps via robots.txt and /sitemap.xml, following indexes
+// and gzipped files
+func TestSitemapSeeds(t *testing.T) {
+	home, _ := url.Parse(baseURL)
+	seeds := newCrawler(DefaultOptions()).sitemapSeeds(context.Background(), home)
+	sort.Strings(seeds)
+	wanted := []string{baseURL, baseURL + "about.html", baseURL + "orphan.html"}
+	if strings.Join(seeds, " ") != strings.Join(wanted, " ") {
+		t.Errorf("got %v, wanted %v", seeds, wanted)
+	}
+}
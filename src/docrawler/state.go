@@ -0,0 +1,294 @@
+package docrawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFileName is the name of the crawl log in a state directory
+const stateFileName = "crawl.log"
+
+// state log operations
+const (
+	opStart = "start" // the crawl (re)started, from Seed
+	opQueue = "queue" // Queue was queued up to crawl
+	opDone  = "done"  // Item finished crawling
+)
+
+// custom errors
+var (
+	errStateSeed = errors.New("state directory is for a different crawl")
+)
+
+// stateStore keeps a crawl's progress on disk as it runs, so it can be resumed if it's
+// interrupted. it's an append-only log of JSON records, one per line: every item we queue up,
+// and every item's results once it's crawled. anything queued but never done is the frontier.
+type stateStore struct {
+	f       *os.File
+	enc     *json.Encoder
+	done    itemRecords             // results from the log we resumed, by normalized URL
+	pending map[string]*queueRecord // items the log we resumed queued but never finished
+	logger  *log.Logger             // where to log problems writing the log, or nil not to
+}
+
+// stateRecord is a single line of the log
+type stateRecord struct {
+	Op    string
+	Seed  string       `json:",omitempty"`
+	Key   string       `json:",omitempty"`
+	Queue *queueRecord `json:",omitempty"`
+	Item  *itemRecord  `json:",omitempty"`
+}
+
+// queueRecord is enough of a queued item to queue it up again
+type queueRecord struct {
+	URL       string
+	Referrer  string `json:",omitempty"`
+	Depth     int
+	Element   string `json:",omitempty"`
+	InSitemap bool   `json:",omitempty"`
+}
+
+// itemRecord is an item's results, everything we'd otherwise have to fetch it again for
+type itemRecord struct {
+	URL          string
+	Type         itemType
+	Title        string        `json:",omitempty"`
+	Base         string        `json:",omitempty"`
+	Canonical    string        `json:",omitempty"`
+	LastModified time.Time     `json:",omitzero"`
+	ETag         string        `json:",omitempty"`
+	Change       string        `json:",omitempty"`
+	Robots       []string      `json:",omitempty"`
+	Method       string        `json:",omitempty"`
+	Redirects    []Hop         `json:",omitempty"`
+	Status       *Status       `json:",omitempty"`
+	Children     []childRecord `json:",omitempty"`
+}
+
+// itemRecords are the results of a crawl, by normalized URL
+type itemRecords map[string]*itemRecord
+
+// childRecord is a single link from an item
+type childRecord struct {
+	URL      string
+	Element  string `json:",omitempty"`
+	Nofollow bool   `json:",omitempty"`
+}
+
+// openState opens the crawl log in dir for a crawl starting at seed. if resume is set we load
+// whatever's already in it and carry on from there, otherwise we start it afresh.
+func openState(dir string, seed string, resume bool) (*stateStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, stateFileName)
+	s := &stateStore{done: make(itemRecords), pending: make(map[string]*queueRecord)}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if resume {
+		if err := s.load(path, seed); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.f = f
+	s.enc = json.NewEncoder(f)
+	if err := s.enc.Encode(stateRecord{Op: opStart, Seed: seed}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the log at path. a missing log is just an empty one, and a line we can't
+// read (i.e. one only half written when we crashed) is skipped
+func (s *stateStore) load(path string, seed string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var rec stateRecord
+			if json.Unmarshal(line, &rec) == nil {
+				switch {
+				case rec.Op == opStart && rec.Seed != seed:
+					return fmt.Errorf("%w: %v", errStateSeed, rec.Seed)
+				case rec.Op == opQueue && rec.Queue != nil:
+					if _, ok := s.done[rec.Key]; !ok {
+						s.pending[rec.Key] = rec.Queue
+					}
+				case rec.Op == opDone && rec.Item != nil:
+					s.done[rec.Key] = rec.Item
+					delete(s.pending, rec.Key)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close closes the log
+func (s *stateStore) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// queued logs that item has been queued up to crawl, under key
+func (s *stateStore) queued(key string, item *httpItem) {
+	if s == nil {
+		return
+	}
+	q := &queueRecord{URL: item.url.String(), Depth: item.depth, Element: item.element, InSitemap: item.inSitemap}
+	if item.refurl != nil {
+		q.Referrer = item.refurl.String()
+	}
+	s.write(stateRecord{Op: opQueue, Key: key, Queue: q})
+}
+
+// finished logs item's results, under key. items we didn't finish (i.e. because the crawl was
+// interrupted) aren't logged, so they're crawled again if we resume.
+func (s *stateStore) finished(key string, item *httpItem) {
+	if s == nil || item.linkType == tUnknown || item.linkType == tFrontier {
+		return
+	}
+	s.write(stateRecord{Op: opDone, Key: key, Item: newItemRecord(item)})
+}
+
+// write appends rec to the log. each record is a single write, so a crash can only ever lose
+// (or half write) the last one
+func (s *stateStore) write(rec stateRecord) {
+	if err := s.enc.Encode(rec); err != nil {
+		logf(s.logger, "Unable to write crawl state: %v\n", err)
+	}
+}
+
+// result returns the results we already have for key, if we resumed a crawl which got them
+func (s *stateStore) result(key string) (*itemRecord, bool) {
+	if s == nil {
+		return nil, false
+	}
+	rec, ok := s.done[key]
+	return rec, ok
+}
+
+// newItemRecord returns the record of item's results
+func newItemRecord(item *httpItem) *itemRecord {
+	rec := &itemRecord{
+		URL:          item.url.String(),
+		Type:         item.linkType,
+		Title:        item.title,
+		LastModified: item.lastModified,
+		ETag:         item.etag,
+		Change:       item.change,
+		Robots:       item.robots,
+		Method:       item.method,
+	}
+	if item.baseurl != nil {
+		rec.Base = item.baseurl.String()
+	}
+	if item.canonical != nil {
+		rec.Canonical = item.canonical.String()
+	}
+	for _, r := range item.redirects {
+		rec.Redirects = append(rec.Redirects, Hop{URL: r.url.String(), Status: r.status, Location: r.location})
+	}
+	if item.status != nil {
+		rec.Status = &Status{Code: item.status.code, Class: item.status.class, Message: item.status.message, Time: item.status.at.Format(time.RFC3339Nano)}
+	}
+	for _, c := range item.children {
+		rec.Children = append(rec.Children, childRecord{URL: c.url.String(), Element: c.element, Nofollow: c.nofollow})
+	}
+	return rec
+}
+
+// restore fills out the item from a record of its results, instead of crawling it
+func (item *httpItem) restore(rec *itemRecord, c *crawler) {
+	item.linkType = rec.Type
+	item.title = rec.Title
+	item.lastModified = rec.LastModified
+	item.etag = rec.ETag
+	item.change = rec.Change
+	item.robots = rec.Robots
+	item.method = rec.Method
+	item.baseurl, _ = parseOptionalURL(rec.Base)
+	item.canonical, _ = parseOptionalURL(rec.Canonical)
+
+	// each hop redirected to the next one, and the last to wherever its Location pointed
+	item.redirects = nil
+	for _, h := range rec.Redirects {
+		from, err := url.Parse(h.URL)
+		if err != nil {
+			break
+		}
+		to, err := from.Parse(h.Location)
+		if err != nil {
+			break
+		}
+		item.redirects = append(item.redirects, redirect{url: from, status: h.Status, location: h.Location, to: to})
+	}
+
+	item.status = nil
+	if rec.Status != nil {
+		at, _ := time.Parse(time.RFC3339Nano, rec.Status.Time)
+		item.status = &fetchStatus{code: rec.Status.Code, class: rec.Status.Class, message: rec.Status.Message, at: at}
+	}
+
+	item.children = nil
+	for _, child := range rec.Children {
+		newItem, err := newHTTPItem(item, child.URL)
+		if err != nil {
+			continue
+		}
+		newItem.element = child.Element
+		newItem.scope = c.scope.check(newItem.url)
+		newItem.nofollow = child.Nofollow
+		item.children = append(item.children, newItem)
+	}
+}
+
+// restoreQueued returns a new item from the record of it being queued, or nil if it's unusable
+func restoreQueued(q *queueRecord) *httpItem {
+	u, err := url.Parse(q.URL)
+	if err != nil {
+		return nil
+	}
+	item := &httpItem{url: u, depth: q.Depth, element: q.Element, inSitemap: q.InSitemap}
+	item.refurl, _ = parseOptionalURL(q.Referrer)
+	return item
+}
+
+// parseOptionalURL parses rawurl, or returns nil if it's empty
+func parseOptionalURL(rawurl string) (*url.URL, error) {
+	if rawurl == "" {
+		return nil, nil
+	}
+	return url.Parse(rawurl)
+}
@@ -0,0 +1,109 @@
+package docrawler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestResumeCrawl checks a resumed crawl finishes the site without refetching anything
+func TestResumeCrawl(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	links := map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a>`,
+		"/a": `<a href="/c">c</a> <a href="/missing">missing</a>`,
+		"/b": `<a href="/c">c</a>`,
+		"/c": `<a href="/">home</a>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		body, ok := links[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>" + r.URL.Path + "</title>" + body))
+	}))
+	defer ts.Close()
+
+	// crawl part of the site, then the rest of it
+	dir := t.TempDir()
+	opts := Options{Workers: 2, IgnoreRobots: true, MaxPages: 2, StateDir: dir}
+	crawlPages(t, context.Background(), ts.URL+"/", opts)
+	opts.MaxPages = 0
+	opts.Resume = true
+	resumed := sitemapToLocations(crawlPages(t, context.Background(), ts.URL+"/", opts))
+	for path, n := range hits {
+		if n != 1 {
+			t.Errorf("fetched %v %v times, wanted once", path, n)
+		}
+	}
+
+	// which should be the same as crawling it all in one go
+	full := sitemapToLocations(crawlPages(t, context.Background(), ts.URL+"/", Options{Workers: 2, IgnoreRobots: true}))
+	for _, l := range append(resumed, full...) {
+		for i := range l.BrokenStatus {
+			l.BrokenStatus[i].Time = ""
+		}
+	}
+	if !reflect.DeepEqual(resumed, full) {
+		a, _ := locationsToJSON(resumed)
+		b, _ := locationsToJSON(full)
+		t.Errorf("resumed crawl got %v, wanted %v", a, b)
+	}
+
+	// and we can't resume the same state with a different seed
+	if _, _, err := doCrawl(context.Background(), ts.URL+"/a", opts); !errors.Is(err, errStateSeed) {
+		t.Errorf("resuming a crawl of a different site got %v, wanted %v", err, errStateSeed)
+	}
+}
+
+// TestStateLoad checks what we load from a log, including one cut off part way through a line
+func TestStateLoad(t *testing.T) {
+	dir := t.TempDir()
+	log := `{"Op":"start","Seed":"http://a.com/"}
+{"Op":"queue","Key":"http://a.com/","Queue":{"URL":"http://a.com/","Depth":0}}
+{"Op":"queue","Key":"http://a.com/x","Queue":{"URL":"http://a.com/x","Referrer":"http://a.com/","Depth":1}}
+{"Op":"done","Key":"http://a.com/","Item":{"URL":"http://a.com/","Type":1,"Children":[{"URL":"http://a.com/x","Element":"a"}]}}
+{"Op":"queue","Key":"http://a.com/y","Queue":{"URL":"ht`
+	if err := ioutil.WriteFile(filepath.Join(dir, stateFileName), []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openState(dir, "http://a.com/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	if len(s.done) != 1 || s.done["http://a.com/"] == nil || s.done["http://a.com/"].Type != tHTMLPage {
+		t.Errorf("got done %v", s.done)
+	}
+	if len(s.pending) != 1 || s.pending["http://a.com/x"] == nil || s.pending["http://a.com/x"].Depth != 1 {
+		t.Errorf("got pending %v", s.pending)
+	}
+
+	if _, err := openState(dir, "http://b.com/", true); !errors.Is(err, errStateSeed) {
+		t.Errorf("got %v, wanted %v", err, errStateSeed)
+	}
+
+	// and not resuming starts again
+	s, err = openState(dir, "http://b.com/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.close()
+	if s, err = openState(dir, "http://b.com/", true); err != nil || len(s.done) != 0 || len(s.pending) != 0 {
+		t.Errorf("got %v, %v after starting again", s, err)
+	}
+	s.close()
+}
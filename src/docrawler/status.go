@@ -0,0 +1,62 @@
+package docrawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// error classes, so broken links can be triaged by why they're broken
+const (
+	classDNS      = "dns"      // the host couldn't be resolved
+	classTLS      = "tls"      // the TLS handshake or certificate verification failed
+	classTimeout  = "timeout"  // the server took too long
+	classRefused  = "refused"  // nothing was listening
+	classProtocol = "protocol" // any other network or http level failure
+	classRedirect = "redirect" // a redirect loop, or too many redirects
+	classHTTP     = "http"     // the server responded, but not with a 200
+	classContent  = "content"  // a missing or unparseable Content-Type
+)
+
+// fetchStatus is why an item is broken
+type fetchStatus struct {
+	code    int       // http status code, or 0 if we never got a response
+	class   string    // one of the class* constants
+	message string    // the error itself
+	at      time.Time // when it happened
+}
+
+// classifyError returns the class of a failed request's error
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var headerErr tls.RecordHeaderError
+	var authErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.Is(err, errRedirectLoop), errors.Is(err, errTooManyRedirects):
+		return classRedirect
+	case errors.As(err, &dnsErr):
+		return classDNS
+	case errors.As(err, &certErr), errors.As(err, &headerErr), errors.As(err, &authErr),
+		errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return classTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return classTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return classRefused
+	}
+	return classProtocol
+}
+
+// fail marks the item broken, recording why
+func (item *httpItem) fail(class string, code int, err error) {
+	item.linkType = tBroken
+	item.status = &fetchStatus{code: code, class: class, message: err.Error(), at: time.Now().UTC()}
+}
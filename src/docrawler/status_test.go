@@ -0,0 +1,116 @@
+package docrawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestClassifyError verifies we put errors from real failed requests in the right class
+func TestClassifyError(t *testing.T) {
+	// a server which never answers in time, one with a certificate we don't trust, one which
+	// speaks gibberish, and an address nothing is listening on
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer slow.Close()
+	untrusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer untrusted.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("this isn't http\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{slow.URL, classTimeout},
+		{untrusted.URL, classTLS},
+		{"http://" + l.Addr().String() + "/", classProtocol},
+		{closed.URL, classRefused},
+		{"http://doesntexist23492387492837492374982734.com/", classDNS},
+	}
+	for _, test := range tests {
+		_, err := client.Get(test.url)
+		if err == nil {
+			t.Errorf("%v: expected an error", test.url)
+			continue
+		}
+		if got := classifyError(err); got != test.want {
+			t.Errorf("%v: got %v, wanted %v (%v)", test.url, got, test.want, err)
+		}
+	}
+
+	// and our own errors
+	if got := classifyError(fmt.Errorf("wrapped: %w", errRedirectLoop)); got != classRedirect {
+		t.Errorf("got %v for a redirect loop", got)
+	}
+	if got := classifyError(errors.New("something else")); got != classProtocol {
+		t.Errorf("got %v for an unknown error", got)
+	}
+	if got := classifyError(context.DeadlineExceeded); got != classTimeout {
+		t.Errorf("got %v for a deadline", got)
+	}
+}
+
+// TestBrokenStatus verifies that broken items record why they're broken
+func TestBrokenStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/notype":
+			w.Header()["Content-Type"] = nil
+		case "/badtype":
+			w.Header().Set("Content-Type", "text/html; charset")
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		path  string
+		code  int
+		class string
+	}{
+		{"/error", 500, classHTTP},
+		{"/notype", 200, classContent},
+		{"/badtype", 200, classContent},
+	}
+	c := newCrawler(DefaultOptions())
+	for _, test := range tests {
+		item, err := newHTTPItem(nil, ts.URL+test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := time.Now()
+		item.crawlItem(context.Background(), c)
+		if item.linkType != tBroken || item.status == nil {
+			t.Errorf("%v: wasn't broken", test.path)
+			continue
+		}
+		s := item.status
+		if s.code != test.code || s.class != test.class || s.message == "" || s.at.Before(before.Add(-time.Second)) {
+			t.Errorf("%v: got status %+v", test.path, s)
+		}
+	}
+}
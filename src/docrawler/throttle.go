@@ -0,0 +1,203 @@
+package docrawler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttle constants
+const (
+	maxRetries     = 2               // how many times we retry a request the server said to back off on
+	defaultBackoff = time.Second     // backoff when a server says to slow down, but not for how long
+	maxBackoff     = 2 * time.Minute // the longest we'll honor a Retry-After for
+	backoffGrowth  = 2               // how much the default backoff grows with each consecutive refusal
+)
+
+// hostThrottle is the rate limiting state for a single host
+type hostThrottle struct {
+	mu          sync.Mutex
+	tat         time.Time     // "theoretical arrival time" of the next request, for the token bucket
+	last        time.Time     // when the most recent request was allowed to go out
+	pausedUntil time.Time     // set when the server tells us to back off
+	crawlDelay  time.Duration // from robots.txt
+	backoff     time.Duration // current backoff, grows with consecutive refusals
+}
+
+// throttle is a per host token bucket rate limiter, with an optional minimum delay between
+// requests to the same host. the bucket refills at rps tokens per second and holds at most
+// burst tokens, so up to burst requests can go out back to back.
+type throttle struct {
+	rps      float64
+	burst    int
+	minDelay time.Duration
+	mu       sync.Mutex
+	hosts    map[string]*hostThrottle
+}
+
+// newThrottle returns a throttle; an rps of 0 means no rate limit
+func newThrottle(rps float64, burst int, minDelay time.Duration) *throttle {
+	if burst < 1 {
+		burst = 1
+	}
+	return &throttle{rps: rps, burst: burst, minDelay: minDelay, hosts: make(map[string]*hostThrottle)}
+}
+
+// host returns the state for a single host, creating it if needed
+func (t *throttle) host(host string) *hostThrottle {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostThrottle{}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// reserve books the next request slot for host and returns when it's allowed to go out
+func (t *throttle) reserve(host string, now time.Time) time.Time {
+	h := t.host(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// start now, unless the server asked us to back off
+	at := now
+	if h.pausedUntil.After(at) {
+		at = h.pausedUntil
+	}
+
+	// keep at least the minimum delay (ours or robots.txt's, whichever is longer) between requests
+	delay := t.minDelay
+	if h.crawlDelay > delay {
+		delay = h.crawlDelay
+	}
+	if !h.last.IsZero() && h.last.Add(delay).After(at) {
+		at = h.last.Add(delay)
+	}
+
+	// and take a token from the bucket (GCRA, which is equivalent to a token bucket)
+	if t.rps > 0 {
+		interval := time.Duration(float64(time.Second) / t.rps)
+		tolerance := time.Duration(t.burst-1) * interval
+		tat := h.tat
+		if tat.Before(at) {
+			tat = at
+		}
+		if allowed := tat.Add(-tolerance); allowed.After(at) {
+			at = allowed
+		}
+		h.tat = tat.Add(interval)
+	}
+
+	h.last = at
+	return at
+}
+
+// wait blocks until a request to host is allowed, or ctx is done
+func (t *throttle) wait(ctx context.Context, host string) error {
+	now := time.Now()
+	at := t.reserve(host, now)
+	if !at.After(now) {
+		return nil
+	}
+	timer := time.NewTimer(at.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setCrawlDelay sets the robots.txt Crawl-delay for host
+func (t *throttle) setCrawlDelay(host string, d time.Duration) {
+	h := t.host(host)
+	h.mu.Lock()
+	h.crawlDelay = d
+	h.mu.Unlock()
+}
+
+// slowDown pauses all requests to host for d or, if the server didn't say how long, for an
+// ever increasing default backoff. it returns how long the host is paused for.
+func (t *throttle) slowDown(host string, d time.Duration, ok bool) time.Duration {
+	h := t.host(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !ok {
+		if h.backoff == 0 {
+			h.backoff = defaultBackoff
+		} else if h.backoff < maxBackoff {
+			h.backoff *= backoffGrowth
+		}
+		d = h.backoff
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	if until := time.Now().Add(d); until.After(h.pausedUntil) {
+		h.pausedUntil = until
+	}
+	return d
+}
+
+// recovered resets the default backoff for host after a successful request
+func (t *throttle) recovered(host string) {
+	h := t.host(host)
+	h.mu.Lock()
+	h.backoff = 0
+	h.mu.Unlock()
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or an
+// http date. it returns false if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if when.Before(now) {
+			return 0, true
+		}
+		return when.Sub(now), true
+	}
+	return 0, false
+}
+
+// throttledTransport is an http.RoundTripper which rate limits requests per host, and backs
+// off (and retries) when a server responds with 429 Too Many Requests or 503 Service Unavailable
+type throttledTransport struct {
+	next     http.RoundTripper
+	throttle *throttle
+}
+
+// RoundTrip implements http.RoundTripper
+func (tt *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	for attempt := 0; ; attempt++ {
+		if err := tt.throttle.wait(req.Context(), host); err != nil {
+			return nil, err
+		}
+		resp, err := tt.next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			tt.throttle.recovered(host)
+			return resp, nil
+		}
+
+		// the server wants us to slow down. pause this host, and try again if we can
+		d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		tt.throttle.slowDown(host, d, ok)
+		if attempt >= maxRetries || req.Body != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
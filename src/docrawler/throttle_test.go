@@ -0,0 +1,81 @@
+package docrawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestThrottleRate verifies that the token bucket allows a burst, then spaces requests out
+func TestThrottleRate(t *testing.T) {
+	th := newThrottle(10, 3, 0)
+	now := time.Now()
+	wanted := []time.Duration{0, 0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, w := range wanted {
+		if at := th.reserve("a.com", now); at.Sub(now) != w {
+			t.Errorf("request %v: got delay %v, wanted %v", i, at.Sub(now), w)
+		}
+	}
+
+	// other hosts have their own bucket
+	if at := th.reserve("b.com", now); !at.Equal(now) {
+		t.Error("hosts aren't throttled independently")
+	}
+}
+
+// TestThrottleDelay verifies the minimum delay, and that a longer robots.txt Crawl-delay wins
+func TestThrottleDelay(t *testing.T) {
+	th := newThrottle(0, 1, 50*time.Millisecond)
+	now := time.Now()
+	th.reserve("a.com", now)
+	if at := th.reserve("a.com", now); at.Sub(now) != 50*time.Millisecond {
+		t.Errorf("got delay %v", at.Sub(now))
+	}
+	th.setCrawlDelay("a.com", time.Second)
+	if at := th.reserve("a.com", now); at.Sub(now) != 1050*time.Millisecond {
+		t.Errorf("got delay %v", at.Sub(now))
+	}
+}
+
+// TestParseRetryAfter verifies both forms of Retry-After
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 2, 17, 12, 0, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter("120", now); !ok || d != 2*time.Minute {
+		t.Errorf("got %v, %v", d, ok)
+	}
+	if d, ok := parseRetryAfter("Tue, 17 Feb 2015 12:00:30 GMT", now); !ok || d != 30*time.Second {
+		t.Errorf("got %v, %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("", now); ok {
+		t.Error("missing Retry-After should not parse")
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Error("bogus Retry-After should not parse")
+	}
+}
+
+// TestThrottledTransportRetry verifies that we back off and retry when told to slow down
+func TestThrottledTransportRetry(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &throttledTransport{next: http.DefaultTransport, throttle: newThrottle(0, 1, 0)}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Errorf("got status %v after %v requests", resp.StatusCode, requests)
+	}
+}
@@ -0,0 +1,405 @@
+package docrawler
+
+import (
+	"bufio"
+	"html"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// tokenType is an enum so we know what kind of token the tokenizer produced
+type tokenType int
+
+// enums for tokenType
+const (
+	tokText tokenType = iota
+	tokStartTag
+	tokEndTag
+	tokSelfClosingTag
+	tokComment
+	tokDoctype
+)
+
+// attribute is a single key="value" pair from a tag, along with its position in the document
+type attribute struct {
+	key  string
+	val  string
+	line int
+	col  int
+}
+
+// token is a single lexical piece of an HTML document (a tag, a run of text, a comment, etc.)
+type token struct {
+	typ   tokenType
+	data  string // tag name (lower case) for tags, otherwise the raw text
+	attrs []attribute
+	line  int
+	col   int
+}
+
+// attr returns the value of the named attribute, and whether it was present at all
+func (t *token) attr(key string) (string, bool) {
+	for _, a := range t.attrs {
+		if a.key == key {
+			return a.val, true
+		}
+	}
+	return "", false
+}
+
+// rawTextElements are elements whose content is not markup, so we don't look for tags inside
+// them until we find the matching end tag (i.e. <script>"<a href=...>"</script> is not a link)
+var rawTextElements = map[string]bool{
+	"script":    true,
+	"style":     true,
+	"title":     true,
+	"textarea":  true,
+	"xmp":       true,
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"plaintext": true,
+}
+
+// pendingRune is a rune which has been pushed back onto the input, along with its position
+type pendingRune struct {
+	r         rune
+	line, col int
+}
+
+// tokenizer is a small streaming HTML tokenizer. it's not a full HTML5 parser (no tree
+// construction), but it handles the lexical rules we care about for finding links: quoted,
+// single quoted and unquoted attributes, comments, doctypes and raw text elements
+type tokenizer struct {
+	r       *bufio.Reader
+	pending []pendingRune
+	line    int // line of the next rune to be read (1 based)
+	col     int // column of the next rune to be read (1 based)
+	rawTag  string
+	err     error
+}
+
+// newTokenizer returns a tokenizer reading HTML from r
+func newTokenizer(r io.Reader) *tokenizer {
+	return &tokenizer{r: bufio.NewReader(r), line: 1, col: 1}
+}
+
+// readRune returns the next rune of input, keeping track of line and column
+func (z *tokenizer) readRune() (rune, bool) {
+	var r rune
+	if n := len(z.pending); n > 0 {
+		r = z.pending[n-1].r
+		z.pending = z.pending[:n-1]
+	} else {
+		if z.err != nil {
+			return 0, false
+		}
+		var err error
+		r, _, err = z.r.ReadRune()
+		if err != nil {
+			z.err = err
+			return 0, false
+		}
+	}
+
+	// advance our position
+	if r == '\n' {
+		z.line++
+		z.col = 1
+	} else {
+		z.col++
+	}
+	return r, true
+}
+
+// unreadRune pushes r back onto the input; line and col are the position r was read from
+func (z *tokenizer) unreadRune(r rune, line, col int) {
+	z.pending = append(z.pending, pendingRune{r, line, col})
+	z.line, z.col = line, col
+}
+
+// skipSpace consumes any whitespace
+func (z *tokenizer) skipSpace() {
+	for {
+		line, col := z.line, z.col
+		r, ok := z.readRune()
+		if !ok {
+			return
+		}
+		if !unicode.IsSpace(r) {
+			z.unreadRune(r, line, col)
+			return
+		}
+	}
+}
+
+// readUntil consumes runes until it has consumed the string "end" (or hit the end of
+// input), returning everything before "end"
+func (z *tokenizer) readUntil(end string) string {
+	var b strings.Builder
+	for {
+		r, ok := z.readRune()
+		if !ok {
+			return b.String()
+		}
+		b.WriteRune(r)
+		if strings.HasSuffix(b.String(), end) {
+			s := b.String()
+			return s[:len(s)-len(end)]
+		}
+	}
+}
+
+// next returns the next token in the document. at the end of input it returns io.EOF,
+// otherwise any read error encountered
+func (z *tokenizer) next() (token, error) {
+	if z.rawTag != "" {
+		return z.nextRawText()
+	}
+
+	line, col := z.line, z.col
+	var text strings.Builder
+	for {
+		tline, tcol := z.line, z.col
+		r, ok := z.readRune()
+		if !ok {
+			break
+		}
+		if r != '<' {
+			text.WriteRune(r)
+			continue
+		}
+
+		// we found a '<', see if it starts some markup
+		n, ok := z.readRune()
+		if ok && (n == '!' || n == '/' || n == '?' || isASCIILetter(n)) {
+			if text.Len() > 0 {
+				// flush the text we've got so far, and come back for the markup later
+				z.unreadRune(n, tline, tcol+1)
+				z.unreadRune('<', tline, tcol)
+				break
+			}
+			return z.nextMarkup(n, tline, tcol), nil
+		}
+
+		// not markup, just a literal '<'
+		text.WriteRune('<')
+		if ok {
+			z.unreadRune(n, tline, tcol+1)
+		}
+	}
+
+	if text.Len() > 0 {
+		return token{typ: tokText, data: text.String(), line: line, col: col}, nil
+	}
+	if z.err == io.EOF {
+		return token{}, io.EOF
+	}
+	return token{}, z.err
+}
+
+// nextMarkup reads the markup (tag, comment, doctype) which began with '<' followed by rune n
+func (z *tokenizer) nextMarkup(n rune, line, col int) token {
+	switch {
+	case n == '!':
+		// comment or doctype
+		if z.consume("--") {
+			return token{typ: tokComment, data: z.readUntil("-->"), line: line, col: col}
+		}
+		return token{typ: tokDoctype, data: z.readUntil(">"), line: line, col: col}
+
+	case n == '?':
+		// processing instruction, treated like a "bogus comment"
+		return token{typ: tokComment, data: z.readUntil(">"), line: line, col: col}
+
+	case n == '/':
+		// end tag, anything but a letter here is a "bogus comment"
+		nline, ncol := z.line, z.col
+		r, ok := z.readRune()
+		if !ok {
+			return token{typ: tokText, data: "</", line: line, col: col}
+		}
+		if !isASCIILetter(r) {
+			z.unreadRune(r, nline, ncol)
+			return token{typ: tokComment, data: z.readUntil(">"), line: line, col: col}
+		}
+		name := z.readTagName(r)
+		z.readUntil(">")
+		return token{typ: tokEndTag, data: name, line: line, col: col}
+	}
+
+	// must be a start tag
+	t := token{typ: tokStartTag, data: z.readTagName(n), line: line, col: col}
+	t.attrs, t.typ = z.readAttributes()
+
+	// switch to raw text mode if needed. we allow xhtml style self closing tags like
+	// <script src="x.js"/> even though html5 doesn't, since they're common in the wild
+	if t.typ == tokStartTag && rawTextElements[t.data] {
+		z.rawTag = t.data
+	}
+	return t
+}
+
+// consume reads the string s from the input if it's next, otherwise leaves the input untouched
+func (z *tokenizer) consume(s string) bool {
+	var read []pendingRune
+	for _, want := range s {
+		line, col := z.line, z.col
+		r, ok := z.readRune()
+		if ok {
+			read = append(read, pendingRune{r, line, col})
+		}
+		if !ok || r != want {
+			// put back everything we read, in reverse order
+			for i := len(read) - 1; i >= 0; i-- {
+				z.unreadRune(read[i].r, read[i].line, read[i].col)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// readTagName reads a tag name beginning with the rune first, and returns it in lower case
+func (z *tokenizer) readTagName(first rune) string {
+	var b strings.Builder
+	b.WriteRune(unicode.ToLower(first))
+	for {
+		line, col := z.line, z.col
+		r, ok := z.readRune()
+		if !ok {
+			break
+		}
+		if unicode.IsSpace(r) || r == '/' || r == '>' {
+			z.unreadRune(r, line, col)
+			break
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// readAttributes reads all of the attributes in a start tag, through its closing '>', and
+// returns them along with whether the tag was self closing
+func (z *tokenizer) readAttributes() ([]attribute, tokenType) {
+	var attrs []attribute
+	for {
+		z.skipSpace()
+		line, col := z.line, z.col
+		r, ok := z.readRune()
+		if !ok || r == '>' {
+			return attrs, tokStartTag
+		}
+		if r == '/' {
+			nline, ncol := z.line, z.col
+			n, ok := z.readRune()
+			if !ok || n == '>' {
+				return attrs, tokSelfClosingTag
+			}
+			z.unreadRune(n, nline, ncol)
+			continue
+		}
+
+		// read the attribute name
+		var name strings.Builder
+		name.WriteRune(unicode.ToLower(r))
+		for {
+			nline, ncol := z.line, z.col
+			r, ok = z.readRune()
+			if !ok {
+				break
+			}
+			if unicode.IsSpace(r) || r == '=' || r == '>' || r == '/' {
+				z.unreadRune(r, nline, ncol)
+				break
+			}
+			name.WriteRune(unicode.ToLower(r))
+		}
+		a := attribute{key: name.String(), line: line, col: col}
+
+		// read the value, if there is one
+		z.skipSpace()
+		if z.consume("=") {
+			z.skipSpace()
+			a.val = html.UnescapeString(z.readAttributeValue())
+		}
+		attrs = append(attrs, a)
+	}
+}
+
+// readAttributeValue reads a double quoted, single quoted or unquoted attribute value
+func (z *tokenizer) readAttributeValue() string {
+	line, col := z.line, z.col
+	r, ok := z.readRune()
+	if !ok {
+		return ""
+	}
+	if r == '"' || r == '\'' {
+		return z.readUntil(string(r))
+	}
+
+	// unquoted, runs until whitespace or the end of the tag
+	z.unreadRune(r, line, col)
+	var b strings.Builder
+	for {
+		line, col = z.line, z.col
+		r, ok = z.readRune()
+		if !ok {
+			break
+		}
+		if unicode.IsSpace(r) || r == '>' {
+			z.unreadRune(r, line, col)
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// nextRawText reads the content of a raw text element (i.e. <script>) up to its end tag
+func (z *tokenizer) nextRawText() (token, error) {
+	line, col := z.line, z.col
+	end := "</" + z.rawTag
+	var b strings.Builder
+	for {
+		r, ok := z.readRune()
+		if !ok {
+			break
+		}
+		b.WriteRune(r)
+		if b.Len() < len(end) || !strings.EqualFold(b.String()[b.Len()-len(end):], end) {
+			continue
+		}
+
+		// make sure this is really the end tag (i.e. not "</scripts")
+		nline, ncol := z.line, z.col
+		n, ok := z.readRune()
+		if ok {
+			z.unreadRune(n, nline, ncol)
+		}
+		if !ok || unicode.IsSpace(n) || n == '/' || n == '>' {
+			// push the end tag back so the next call to next() finds it
+			for i := len(end) - 1; i >= 0; i-- {
+				z.unreadRune(rune(end[i]), z.line, z.col-1)
+			}
+			s := b.String()
+			z.rawTag = ""
+			return token{typ: tokText, data: s[:len(s)-len(end)], line: line, col: col}, nil
+		}
+	}
+
+	z.rawTag = ""
+	if b.Len() > 0 {
+		return token{typ: tokText, data: b.String(), line: line, col: col}, nil
+	}
+	if z.err == io.EOF {
+		return token{}, io.EOF
+	}
+	return token{}, z.err
+}
+
+// isASCIILetter returns true for a-z and A-Z
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
@@ -0,0 +1,66 @@
+package docrawler
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+// tokenizeAll runs the tokenizer over s and returns every token
+func tokenizeAll(t *testing.T, s string) []token {
+	var tokens []token
+	z := newTokenizer(strings.NewReader(s))
+	for {
+		tok, err := z.next()
+		if err == io.EOF {
+			return tokens
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// TestTokenizerTypes verifies we get the right sequence of token types from a small document
+func TestTokenizerTypes(t *testing.T) {
+	tokens := tokenizeAll(t, `<!DOCTYPE html><p a=1>x &lt; y</p><!-- c --><br/>`)
+	wanted := []tokenType{tokDoctype, tokStartTag, tokText, tokEndTag, tokComment, tokSelfClosingTag}
+	if len(tokens) != len(wanted) {
+		t.Fatalf("got %v tokens, wanted %v", len(tokens), len(wanted))
+	}
+	for i, w := range wanted {
+		if tokens[i].typ != w {
+			t.Errorf("token %v: got type %v, wanted %v", i, tokens[i].typ, w)
+		}
+	}
+	if v, ok := tokens[1].attr("a"); !ok || v != "1" {
+		t.Error("attribute not parsed")
+	}
+}
+
+// TestTokenizerRawText verifies that script content isn't tokenized as markup
+func TestTokenizerRawText(t *testing.T) {
+	tokens := tokenizeAll(t, `<script>if (a</b) { x = "<a href='y'>" }</SCRIPT ><p>`)
+	if len(tokens) != 4 {
+		t.Fatalf("got %v tokens, wanted 4", len(tokens))
+	}
+	if tokens[1].typ != tokText || tokens[1].data != `if (a</b) { x = "<a href='y'>" }` {
+		t.Errorf("got script text %q", tokens[1].data)
+	}
+	if tokens[2].typ != tokEndTag || tokens[2].data != "script" {
+		t.Error("script end tag not found")
+	}
+	if tokens[3].typ != tokStartTag || tokens[3].data != "p" {
+		t.Error("tag after script not found")
+	}
+}
+
+// TestTokenizerLiteralLessThan verifies that a '<' which doesn't start markup is just text
+func TestTokenizerLiteralLessThan(t *testing.T) {
+	tokens := tokenizeAll(t, `1 < 2 <b>`)
+	if len(tokens) != 2 || tokens[0].data != "1 < 2 " || tokens[1].data != "b" {
+		t.Logf("got %+v", tokens)
+		t.Error("literal '<' was mishandled")
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package docrawler
 
 import (
 	"errors"
@@ -44,8 +44,9 @@ func resolveURL(referringURL string, currentURL string) (*url.URL, error) {
 	cleanURL(uCurrent)
 	cleanURL(uReferrer)
 
-	// try to resolve it with the referrer
+	// try to resolve it with the referrer, and normalize the result
 	uResolved := uReferrer.ResolveReference(uCurrent)
+	normalizeURL(uResolved)
 
 	// return the URL we ended up with, and the error from checkURL
 	return uResolved, checkURL(uResolved)
@@ -1,4 +1,13 @@
-package main
+package docrawler
+
+import "log"
+
+// logf logs to l, if there is one. the crawler never logs anywhere it hasn't been told to
+func logf(l *log.Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
 
 // uniqStrings takes a slice of strings and removes any duplicates
 // note: does not guarantee any order (or stability of order)
@@ -0,0 +1,158 @@
+package docrawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxWARCRecord is the biggest WARC record we'll read, since we keep every response in memory
+const maxWARCRecord = 256 << 20
+
+// custom errors
+var (
+	errBadWARC = errors.New("not a WARC file")
+)
+
+// LoadWARC returns a MemoryFetcher which serves the responses archived in the WARC file at
+// path, which may be gzipped. a URL archived more than once is served as it was first archived.
+func LoadWARC(path string) (*MemoryFetcher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	f := NewMemoryFetcher()
+	if err := readWARC(file, f); err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return f, nil
+}
+
+// readWARC reads each record of the WARC in r, adding every http response in it to f
+func readWARC(r io.Reader, f *MemoryFetcher) error {
+	br := bufio.NewReader(r)
+	// a .warc.gz is each record gzipped on its own, one after another, which gzip reads as one
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	tp := textproto.NewReader(br)
+	seen := make(map[string]bool)
+	for {
+		// records are separated by blank lines, and each starts with the version
+		line, err := tp.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "WARC/") {
+			return fmt.Errorf("%w: %q", errBadWARC, line)
+		}
+
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return err
+		}
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil || length < 0 || length > maxWARCRecord {
+			return fmt.Errorf("%w: bad Content-Length %q", errBadWARC, header.Get("Content-Length"))
+		}
+		// read what's actually there, rather than trusting the length to allocate up front
+		block, err := ioutil.ReadAll(io.LimitReader(br, length))
+		if err != nil {
+			return err
+		}
+		if int64(len(block)) < length {
+			return io.ErrUnexpectedEOF
+		}
+
+		if header.Get("WARC-Type") != "response" || !strings.HasPrefix(header.Get("Content-Type"), "application/http") {
+			continue // requests, metadata and so on
+		}
+		target := strings.Trim(header.Get("WARC-Target-URI"), "<>")
+		if seen[target] {
+			continue
+		}
+		resp, err := readWARCResponse(block)
+		if err != nil {
+			continue // one bad record needn't spoil the rest
+		}
+		if f.Add(target, resp) == nil {
+			seen[target] = true
+		}
+	}
+}
+
+// readWARCResponse parses the http response archived in a record's block
+func readWARCResponse(block []byte) (*MemoryResponse, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// archives keep the body as it was sent, but we serve it as if it was sent as it is
+	if body, err = decodeBody(resp.Header, body); err != nil {
+		return nil, err
+	}
+	// the body's been read (and de-chunked) already, so its length is just what we've got
+	resp.Header.Del("Content-Length")
+	return &MemoryResponse{Status: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// decodeBody undoes a gzip or deflate Content-Encoding, removing it from header, and returns
+// any other body as it is
+func decodeBody(header http.Header, body []byte) ([]byte, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "deflate":
+		// which is meant to be zlib, but some servers send it raw
+		if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(body))
+		}
+	default:
+		return body, nil
+	}
+	decoded, err := ioutil.ReadAll(io.LimitReader(r, maxWARCRecord+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxWARCRecord {
+		return nil, fmt.Errorf("%w: body bigger than %v bytes once decoded", errBadWARC, maxWARCRecord)
+	}
+	header.Del("Content-Encoding")
+	return decoded, nil
+}
@@ -0,0 +1,126 @@
+package docrawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// warcRecord returns a single WARC record of type typ, for target, holding block
+func warcRecord(typ, target, contentType, block string) string {
+	return fmt.Sprintf("WARC/1.1\r\nWARC-Type: %v\r\nWARC-Target-URI: <%v>\r\nContent-Type: %v\r\nContent-Length: %v\r\n\r\n%v\r\n\r\n",
+		typ, target, contentType, len(block), block)
+}
+
+// testWARC is a small site archived as WARC records, with a bit of everything we skip
+var testWARC = strings.Join([]string{
+	warcRecord("warcinfo", "", "application/warc-fields", "software: test\r\n"),
+	warcRecord("request", "http://a.com/", "application/http; msgtype=request", "GET / HTTP/1.1\r\nHost: a.com\r\n\r\n"),
+	warcRecord("response", "http://a.com/", "application/http; msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 45\r\n\r\n<title>Home</title><a href=\"/moved\">moved</a>"),
+	warcRecord("response", "http://a.com/moved", "application/http; msgtype=response",
+		"HTTP/1.1 301 Moved Permanently\r\nLocation: /about\r\n\r\n"),
+	warcRecord("response", "http://a.com/about", "application/http; msgtype=response",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nTransfer-Encoding: chunked\r\n\r\n13\r\n<title>About</title\r\n1\r\n>\r\n0\r\n\r\n"),
+	warcRecord("response", "http://a.com/about", "application/http; msgtype=response",
+		"HTTP/1.1 500 Internal Server Error\r\n\r\n"),
+}, "")
+
+// TestLoadWARC checks we can crawl a site from a WARC file, gzipped or not
+func TestLoadWARC(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(testWARC))
+	zw.Close()
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"site.warc": []byte(testWARC), "site.warc.gz": gz.Bytes()} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		f, err := LoadWARC(path)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		l := sitemapToLocations(crawlPages(t, context.Background(), "http://a.com/", Options{Workers: 2, IgnoreRobots: true, Fetcher: f}))
+		if len(l) != 2 || l[0].Title != "Home" || l[1].URL != "http://a.com/about" || l[1].Title != "About" {
+			t.Errorf("%v: got %+v", name, l)
+		}
+	}
+
+	if err := readWARC(strings.NewReader("HTTP/1.1 200 OK\r\n\r\n"), NewMemoryFetcher()); !errors.Is(err, errBadWARC) {
+		t.Errorf("got %v for something which isn't a WARC, wanted %v", err, errBadWARC)
+	}
+}
+
+// compressed returns s compressed with w
+func compressed(s string, w func(io.Writer) io.WriteCloser) string {
+	var b bytes.Buffer
+	zw := w(&b)
+	zw.Write([]byte(s))
+	zw.Close()
+	return b.String()
+}
+
+// TestReadWARCEncoding checks that a response archived with a gzip or deflate Content-Encoding
+// is served decoded, and anything else as it was archived
+func TestReadWARCEncoding(t *testing.T) {
+	const page = `<title>Zipped</title>`
+	gzipped := compressed(page, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	zlibbed := compressed(page, func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+	deflated := compressed(page, func(w io.Writer) io.WriteCloser {
+		zw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return zw
+	})
+	response := func(encoding, body string) string {
+		return fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Encoding: %v\r\nContent-Length: %v\r\n\r\n%v", encoding, len(body), body)
+	}
+	warc := warcRecord("response", "http://a.com/", "application/http; msgtype=response", response("gzip", gzipped)) +
+		warcRecord("response", "http://a.com/zlib", "application/http; msgtype=response", response("deflate", zlibbed)) +
+		warcRecord("response", "http://a.com/raw", "application/http; msgtype=response", response("deflate", deflated)) +
+		warcRecord("response", "http://a.com/br", "application/http; msgtype=response", response("br", "brotli"))
+	f := NewMemoryFetcher()
+	if err := readWARC(strings.NewReader(warc), f); err != nil {
+		t.Fatal(err)
+	}
+
+	l := sitemapToLocations(crawlPages(t, context.Background(), "http://a.com/", Options{Workers: 2, IgnoreRobots: true, Fetcher: f}))
+	if len(l) != 1 || l[0].Title != "Zipped" {
+		t.Errorf("got %+v", l)
+	}
+	for _, u := range []string{"http://a.com/", "http://a.com/zlib", "http://a.com/raw"} {
+		if r := f.responses[u]; r == nil || string(r.Body) != page || r.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%v: got %+v", u, r)
+		}
+	}
+	if r := f.responses["http://a.com/br"]; r == nil || string(r.Body) != "brotli" || r.Header.Get("Content-Encoding") != "br" {
+		t.Errorf("got %+v for an encoding we can't decode", r)
+	}
+}
+
+// TestReadWARCLength checks a record's Content-Length can't make us panic, or allocate more
+// than the file holds
+func TestReadWARCLength(t *testing.T) {
+	record := "WARC/1.1\r\nWARC-Type: response\r\nContent-Length: %v\r\n\r\nHTTP/1.1 200 OK\r\n\r\n"
+	tests := map[string]error{
+		"-1":                  errBadWARC,
+		"x":                   errBadWARC,
+		"9223372036854775807": errBadWARC,
+		"100000":              io.ErrUnexpectedEOF,
+	}
+	for length, want := range tests {
+		if err := readWARC(strings.NewReader(fmt.Sprintf(record, length)), NewMemoryFetcher()); !errors.Is(err, want) {
+			t.Errorf("Content-Length %v: got %v, wanted %v", length, err, want)
+		}
+	}
+}